@@ -1,30 +1,208 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 
 	"github.com/BurntSushi/toml"
 )
 
 type Config struct {
-	DocComment        string            `toml:"doc_comment"`
-	IgnoreIndented    bool              `toml:"ignore_indented"`
-	ScanRoot          string            `toml:"scan_root"`
-	ScanExclusions    []string          `toml:"scan_exclusions"`
-	OutputPath        string            `toml:"output_path"`
-	ExtensionsToLangs map[string]string `toml:"extensions_to_langs"`
-	GitAvatarSize     int               `toml:"git_avatar_size"`
+	DocComment            StringList          `toml:"doc_comment" desc:"prefix marking a line as a doc comment, or a list of prefixes for code mixing several styles"`
+	DocCommentByLang      LangPrefixMap       `toml:"doc_comment_by_lang" desc:"doc comment prefixes per language of extensions_to_langs, a string or a list like doc_comment, languages not listed use doc_comment"`
+	DocCommentAuto        bool                `toml:"doc_comment_auto" desc:"detect the doc comment prefix of every file from the most common of ///, //!, #, -- and block comments, doc_comment is used on ties"`
+	DocCommentIsRegex     bool                `toml:"doc_comment_is_regex" desc:"treat doc_comment as a regex matched at the start of the trimmed line, its first capture group is the comment content, e.g. \"#'\" for R roxygen"`
+	BlockCommentStart     string              `toml:"block_comment_start" desc:"opening marker of block doc comments like \"/**\", empty disables block comments"`
+	BlockCommentEnd       string              `toml:"block_comment_end" desc:"closing marker of block doc comments"`
+	StrictColumnZero      bool                `toml:"strict_column_zero" desc:"only treat comments starting at column zero as doc comments, indented ones are handled like code instead of being skipped"`
+	IgnoreIndented        bool                `toml:"ignore_indented" desc:"skip doc comments that are indented, see indent_threshold"`
+	IndentThreshold       int                 `toml:"indent_threshold" desc:"with ignore_indented only comments indented by more than this many columns are skipped, tabs count up to the next multiple of 4"`
+	MaxGapLines           int                 `toml:"max_gap_lines" desc:"how many blank lines may separate a doc comment from its declaration before the comment is treated as standalone, -1 allows any gap"`
+	ScanRoot              string              `toml:"scan_root" desc:"directory scanned for source files"`
+	SkipHidden            bool                `toml:"skip_hidden" desc:"skip dot-prefixed files and directories while scanning unless include_files names them, .git is always skipped"`
+	ScanExclusions        []string            `toml:"scan_exclusions" desc:"glob patterns excluded from scanning, relative to the scan root"`
+	OnlyTracked           bool                `toml:"only_tracked" desc:"inside a git repository only document files tracked by git, applied after scan_exclusions"`
+	OutputPath            string              `toml:"output_path" desc:"directory the generated docs are written to"`
+	WriteConcurrency      int                 `toml:"write_concurrency" desc:"number of pages generated and written at once"`
+	FlatOutput            bool                `toml:"flat_output" desc:"write all docs directly into the output directory, folding source directories into the file names"`
+	OutputCase            string              `toml:"output_case" desc:"case of the output file names, 'preserve', 'lower' or 'kebab', which also splits camelCase and replaces underscores with dashes"`
+	FenceLangs            FenceLangMap        `toml:"fence_langs" desc:"per output format ('markdown' for generated pages, 'html' for pages rendered by serve) maps a language to the token used on its code fences"`
+	ExtensionsToLangs     map[string]string   `toml:"extensions_to_langs" desc:"maps file extensions to the language used for code fences"`
+	GitAvatarSize         int                 `toml:"git_avatar_size" desc:"size in pixels of contributor avatars in the git card"`
+	UnnamedIDPrefix       string              `toml:"unnamed_id_prefix" desc:"prefix of the fallback ID given to elements without a recognizable name"`
+	OnlyExported          bool                `toml:"only_exported" desc:"skip declarations detected as non public, after private:/protected: labels, with a private prefix or unexported go names"`
+	InternalSymbols       string              `toml:"internal_symbols" desc:"how file local c/c++ declarations (static or in an anonymous namespace) are documented, 'show', 'tag' to mark them as internal or 'skip'"`
+	InternalVisibility    []string            `toml:"internal_visibility" desc:"outputs listing internal elements (marked @internal or file local), any of 'page', 'index' for the symbol index and 'json' for symbols.json"`
+	PrivatePrefixes       []string            `toml:"private_prefixes" desc:"name prefixes marking a declaration as private for only_exported"`
+	ReadRetries           int                 `toml:"read_retries" desc:"how many times a failed source file read is retried with backoff, useful on network filesystems"`
+	IncludeFiles          map[string]string   `toml:"include_files" desc:"glob patterns relative to the scan root mapped to a language, matching files are documented regardless of their extension or scan_exclusions"`
+	PassthroughExtensions []string            `toml:"passthrough_extensions" desc:"extensions of files copied verbatim into the output instead of being parsed"`
+	SignatureTrim         map[string][]string `toml:"signature_trim" desc:"trailing tokens stripped from signatures per language, the 'default' entry is used for unlisted languages"`
+	ShowFileStats         bool                `toml:"show_file_stats" desc:"show lines of code and file size for each file"`
+	AnchorStyle           string              `toml:"anchor_style" desc:"how heading anchors are slugged, 'github' matches GitHub and most renderers for unicode and punctuation, 'simple' only lowercases and replaces spaces"`
+	FrontMatter           []string            `toml:"front_matter" desc:"fields of the yaml front matter added to every page, 'title' and 'date' (of the last commit) are supported, empty disables it"`
+	SourceChecksum        bool                `toml:"source_checksum" desc:"add the sha256 of the source file to every page, as a front matter field when front_matter is set and as an html comment otherwise"`
+	ShowBreadcrumbs       bool                `toml:"show_breadcrumbs" desc:"start every page with a Home / dir / file trail linking back to the project index and the directories listed in it"`
+	ElementHeading        string              `toml:"element_heading" desc:"content of element headings, 'id', 'signature' or 'id_and_signature', anchors always use the ID"`
+	TOCModuleHeadings     bool                `toml:"toc_module_headings" desc:"include headings from the module description in the table of contents"`
+	MaxDescriptionLines   int                 `toml:"max_description_lines" desc:"collapse element descriptions longer than this many lines into a 'show more' block, 0 keeps them whole"`
+	WrapSignatures        bool                `toml:"wrap_signatures" desc:"put every parameter of a signature on its own line in the code block"`
+	StructuredSignatures  bool                `toml:"structured_signatures" desc:"render the return type and parameters of c/c++ functions below the signature"`
+	SectionLabels         []string            `toml:"section_labels" desc:"labels like 'Parameters' or 'Returns' rendered as bold subsection headers when they start a description line as 'Label:' or '# Label'"`
+	MergeMarkers          bool                `toml:"merge_markers" desc:"wrap generated pages in <!-- kdoc:begin --> and <!-- kdoc:end --> markers and on later runs only replace what is between them, keeping hand written content around them"`
+	ElementMarkers        bool                `toml:"element_markers" desc:"emit a <!-- kdoc:element id=... file=... line=... --> comment before every element heading for external tooling"`
+	ElementSeparator      string              `toml:"element_separator" desc:"markdown inserted between element sections, e.g. '---' for a horizontal rule, empty inserts nothing"`
+	TrailingNewline       bool                `toml:"trailing_newline" desc:"end generated documents with a single newline, disable to end them without one"`
+	EmptyPlaceholder      string              `toml:"empty_placeholder" desc:"markdown rendered on pages without any documentation, e.g. '*No documentation available.*', empty disables it"`
+	ModuleHeading         string              `toml:"module_heading" desc:"heading placed above the module description, empty renders it without a heading"`
+	DefaultGroup          string              `toml:"default_group" desc:"section of the elements without @group on pages where other elements use @group"`
+	GitChurn              bool                `toml:"git_churn" desc:"show total insertions and deletions over the history of each file in the git card, costs an extra git call per file"`
+	RecentCommits         int                 `toml:"recent_commits" desc:"list the last n commits of each file with hash, date and subject in a collapsible section below the git card, 0 disables it"`
+	AuthorAliases         map[string]string   `toml:"author_aliases" desc:"maps contributor emails to a canonical 'Name <email>' or 'Name', merging identities on top of the repository .mailmap"`
+	GitDateSource         string              `toml:"git_date_source" desc:"date shown for the last commit, 'author' or 'committer', which reflects when rebased or cherry-picked changes landed"`
+	GitMaxConcurrency     int                 `toml:"git_max_concurrency" desc:"maximum number of git processes running at once"`
+	GitHubToken           string              `toml:"github_token" desc:"token used to resolve contributor GitHub accounts through the API for avatars and profile links, environment variables like '$GITHUB_TOKEN' are expanded, empty disables it"`
+	Offline               bool                `toml:"offline" desc:"don't generate links or images pointing at external services like the git provider, github.com or gravatar, the git card renders plain text instead"`
+	GitCard               bool                `toml:"git_card" desc:"render the git card, git metadata is still collected for front matter and indexes when disabled"`
+	GitCardLayout         string              `toml:"git_card_layout" desc:"layout of the git card, 'table' or 'stacked', which puts every section below each other for narrow screens"`
+	UncommittedCard       bool                `toml:"uncommitted_card" desc:"render a placeholder card for files without git history instead of leaving the card out, no warning is reported for them"`
+	MinCommitsForCard     int                 `toml:"min_commits_for_card" desc:"only render the git card for files with at least this many commits"`
+	GenerateIndex         bool                `toml:"generate_index" desc:"generate the project index listing every documented file"`
+	IndexFiles            []string            `toml:"index_files" desc:"file names the project index is written to, add 'README.md' so hosts like GitHub show it when browsing the output directory"`
+	IndexOrder            []string            `toml:"index_order" desc:"glob patterns of source paths relative to the scan root in the order their files should appear in the indexes, unlisted files follow sorted by path"`
+	IndexStyle            string              `toml:"index_style" desc:"layout of the index, 'files' lists every file, 'namespace' renders the documented symbols as a tree of their namespaces"`
+	IndexReadme           string              `toml:"index_readme" desc:"markdown file relative to the scan root, usually 'README.md', used as the body of the index with the generated listing below it, empty disables it"`
+	IndexTodos            bool                `toml:"index_todos" desc:"count TODO and FIXME markers in every source file and show the count next to the file in the index"`
+	LanguageIndexes       bool                `toml:"language_indexes" desc:"also generate a <language>-index.md for every language, listing only its files"`
+	SymbolIndex           bool                `toml:"symbol_index" desc:"generate symbols-index.md listing every documented symbol alphabetically"`
+	SymbolJSON            bool                `toml:"symbol_json" desc:"generate symbols.json listing every documented symbol with its source path, comment line and signature line"`
+	FeedBaseURL           string              `toml:"feed_base_url" desc:"public URL of the output directory, when set feed.json, a JSON Feed of the pages ordered by their last commit, is generated"`
+	IndexCommitHash       bool                `toml:"index_commit_hash" desc:"annotate the table of contents and symbol index with the linked last commit hash of each file"`
+	CommitHashLength      int                 `toml:"commit_hash_length" desc:"length of shortened commit hashes"`
+	RelatedFiles          string              `toml:"related_files" desc:"list related files on each page, 'directory' or 'contributor', empty disables it"`
+	ExternalRefs          map[string]string   `toml:"external_refs" desc:"links for backlinks to symbols outside the project, e.g. 'std::vector' = 'https://en.cppreference.com/w/cpp/container/vector', used when the symbol is not documented locally"`
+	Git                   GitConfig           `toml:"git" desc:"git card settings"`
+}
+
+// output format to language to code fence token
+type FenceLangMap map[string]map[string]string
+
+// language to doc comment prefixes
+type LangPrefixMap map[string]StringList
+
+// DocCommentFor returns the doc comment prefixes of lang, doc_comment_by_lang falls back to doc_comment
+func (c *Config) DocCommentFor(lang string) StringList {
+	if prefixes, ok := c.DocCommentByLang[lang]; ok {
+		return prefixes
+	}
+
+	return c.DocComment
+}
+
+// StringList is a list of strings that also accepts a single string in toml
+type StringList []string
+
+func (l *StringList) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case string:
+		*l = StringList{v}
+	case []any:
+		list := make(StringList, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected a string, got %T", item)
+			}
+			list = append(list, str)
+		}
+		*l = list
+	default:
+		return fmt.Errorf("expected a string or a list of strings, got %T", v)
+	}
+
+	return nil
+}
+
+type GitConfig struct {
+	Labels GitLabels `toml:"labels" desc:"labels used in the git card"`
+}
+
+// labels used in the git card, can be overwritten for localized or branded docs
+type GitLabels struct {
+	Title        string `toml:"title" desc:"heading of the git card"`
+	LastUpdate   string `toml:"last_update" desc:"label for the last commit"`
+	Repository   string `toml:"repository" desc:"label for the repository link"`
+	Branch       string `toml:"branch" desc:"label for the current branch"`
+	History      string `toml:"history" desc:"label for the commit count"`
+	Stats        string `toml:"stats" desc:"label for the file stats"`
+	Churn        string `toml:"churn" desc:"label for the insertion and deletion totals"`
+	Contributors string `toml:"contributors" desc:"label for the contributor list"`
+	Recent       string `toml:"recent" desc:"summary of the collapsible list of recent commits"`
+	Uncommitted  string `toml:"uncommitted" desc:"text of the placeholder card of files without git history"`
 }
 
 var CFG = Config{
-	DocComment:        "///",
-	IgnoreIndented:    false,
-	ScanRoot:          "./",
-	ScanExclusions:    []string{"*.md", "*.txt", "*.cmake", "cmake-build-*"},
-	OutputPath:        "./docs",
-	ExtensionsToLangs: map[string]string{".cpp": "cpp", ".c": "c", ".h": "cpp", ".hpp": "cpp"},
-	GitAvatarSize:     32,
+	DocComment:            StringList{"///"},
+	DocCommentByLang:      LangPrefixMap{},
+	BlockCommentStart:     "",
+	BlockCommentEnd:       "*/",
+	IgnoreIndented:        false,
+	MaxGapLines:           -1,
+	ScanRoot:              "./",
+	SkipHidden:            true,
+	ScanExclusions:        []string{"*.md", "*.txt", "*.cmake", "cmake-build-*"},
+	OutputPath:            "./docs",
+	WriteConcurrency:      8,
+	OutputCase:            "preserve",
+	ExtensionsToLangs:     map[string]string{".cpp": "cpp", ".c": "c", ".h": "cpp", ".hpp": "cpp"},
+	GitAvatarSize:         32,
+	CommitHashLength:      7,
+	GitCard:               true,
+	GitCardLayout:         "table",
+	GitDateSource:         "author",
+	GitMaxConcurrency:     4,
+	PassthroughExtensions: []string{},
+	IncludeFiles:          map[string]string{},
+	PrivatePrefixes:       []string{"_"},
+	UnnamedIDPrefix:       "unnamed_",
+	InternalSymbols:       "show",
+	InternalVisibility:    []string{"page", "index", "json"},
+	ElementHeading:        "id",
+	DefaultGroup:          "Other",
+	AnchorStyle:           "github",
+	GenerateIndex:         true,
+	IndexStyle:            "files",
+	IndexFiles:            []string{"index.md"},
+	TrailingNewline:       true,
+	ExternalRefs:          map[string]string{},
+	AuthorAliases:         map[string]string{},
+	SignatureTrim: map[string][]string{
+		"default":    {"{"},
+		"c":          {"{", ";"},
+		"cpp":        {"{", ";"},
+		"python":     {":"},
+		"javascript": {"{", "=>", ";"},
+		"typescript": {"{", "=>", ";"},
+	},
+	Git: GitConfig{
+		Labels: GitLabels{
+			Title:        "File Information",
+			LastUpdate:   "Last Update",
+			Repository:   "Repository",
+			Branch:       "Branch",
+			History:      "History",
+			Stats:        "Stats",
+			Churn:        "Churn",
+			Contributors: "Contributors",
+			Recent:       "Recent changes",
+			Uncommitted:  "Not yet committed",
+		},
+	},
 }
 
 // testing comment, loads the config
@@ -37,6 +215,59 @@ func Load(config_path string) error {
 	return err
 }
 
+// keys of per directory kdoc.toml files that are applied to the files below them, the rest
+// of the config is project wide and only read from the root kdoc.toml
+var DirectoryKeys = []string{"doc_comment", "doc_comment_by_lang", "doc_comment_auto", "ignore_indented", "extensions_to_langs"}
+
+// LoadOverride merges the config file at config_path on top of base without modifying base,
+// used for per directory kdoc.toml files, keys not in DirectoryKeys are left out and returned
+func LoadOverride(config_path string, base Config) (Config, []string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(base); err != nil {
+		return base, nil, err
+	}
+
+	// round trip through toml so maps and slices are not shared with base
+	var merged Config
+	if _, err := toml.Decode(buf.String(), &merged); err != nil {
+		return base, nil, err
+	}
+
+	md, err := toml.DecodeFile(config_path, &merged)
+	if err != nil {
+		return base, nil, err
+	}
+
+	var ignored []string
+	for _, key := range md.Keys() {
+		name := key[0]
+		if len(key) > 1 || slices.Contains(ignored, name) {
+			continue
+		}
+		if !slices.Contains(DirectoryKeys, name) {
+			ignored = append(ignored, name)
+		}
+	}
+
+	// project wide keys keep the values of base
+	for _, name := range ignored {
+		copyField(&merged, &base, name)
+	}
+
+	return merged, ignored, nil
+}
+
+// sets the field of dst with the toml key to its value in src
+func copyField(dst, src *Config, key string) {
+	d, v := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for i := range d.NumField() {
+		if d.Type().Field(i).Tag.Get("toml") == key {
+			d.Field(i).Set(v.Field(i))
+			return
+		}
+	}
+}
+
 // testing comment, saves the config
 func Save(config_path string) error {
 	dir := filepath.Dir(config_path)
@@ -52,3 +283,8 @@ func Save(config_path string) error {
 
 	return toml.NewEncoder(f).Encode(CFG)
 }
+
+// Encode writes cfg as toml, the same format Save uses
+func Encode(w io.Writer, cfg Config) error {
+	return toml.NewEncoder(w).Encode(cfg)
+}
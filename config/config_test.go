@@ -0,0 +1,29 @@
+package config
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestDocCommentList(t *testing.T) {
+	for src, want := range map[string]StringList{
+		`doc_comment = "//!"`:              {"//!"},
+		`doc_comment = ["///", "//", "#"]`: {"///", "//", "#"},
+	} {
+		var cfg Config
+		if _, err := toml.Decode(src, &cfg); err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if !slices.Equal(cfg.DocComment, want) {
+			t.Errorf("%s: doc_comment = %q, want %q", src, cfg.DocComment, want)
+		}
+	}
+
+	var cfg Config
+	if _, err := toml.Decode(`doc_comment = ["///", 3]`, &cfg); err == nil {
+		t.Error("a list with a non string entry was accepted")
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Schema builds a JSON Schema describing every config field, defaults are taken from CFG
+// so this should be called before any config file is loaded
+func Schema() map[string]any {
+	schema := structSchema(reflect.ValueOf(CFG))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "kdoc.toml"
+	return schema
+}
+
+func structSchema(v reflect.Value) map[string]any {
+	t := v.Type()
+	props := make(map[string]any)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		prop := valueSchema(v.Field(i))
+		if desc := field.Tag.Get("desc"); desc != "" {
+			prop["description"] = desc
+		}
+
+		props[name] = prop
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+func valueSchema(v reflect.Value) map[string]any {
+	if list, ok := v.Interface().(StringList); ok {
+		s := map[string]any{"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		}}
+		if list != nil {
+			s["default"] = list
+		}
+		return s
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return structSchema(v)
+	case reflect.String:
+		return map[string]any{"type": "string", "default": v.Interface()}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean", "default": v.Interface()}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer", "default": v.Interface()}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number", "default": v.Interface()}
+	case reflect.Slice:
+		s := map[string]any{
+			"type":  "array",
+			"items": typeSchema(v.Type().Elem()),
+		}
+		if !v.IsNil() {
+			s["default"] = v.Interface()
+		}
+		return s
+	case reflect.Map:
+		s := map[string]any{
+			"type":                 "object",
+			"additionalProperties": typeSchema(v.Type().Elem()),
+		}
+		if !v.IsNil() {
+			s["default"] = v.Interface()
+		}
+		return s
+	}
+
+	return map[string]any{}
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+	s := valueSchema(reflect.New(t).Elem())
+	delete(s, "default")
+	return s
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := json.Marshal(Schema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type property struct {
+		Type        string           `json:"type"`
+		Default     any              `json:"default"`
+		Description string           `json:"description"`
+		OneOf       []map[string]any `json:"oneOf"`
+		Properties  map[string]any   `json:"properties"`
+	}
+	var schema struct {
+		Properties map[string]property `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	out, ok := schema.Properties["output_path"]
+	if !ok || out.Type != "string" || out.Default != "./docs" || out.Description == "" {
+		t.Errorf("output_path = %+v, want a described string defaulting to ./docs", out)
+	}
+
+	doc, ok := schema.Properties["doc_comment"]
+	if !ok || len(doc.OneOf) != 2 || doc.OneOf[0]["type"] != "string" || doc.OneOf[1]["type"] != "array" {
+		t.Errorf("doc_comment = %+v, want a string or a list of strings", doc)
+	}
+
+	if git := schema.Properties["git"]; git.Type != "object" || git.Properties["labels"] == nil {
+		t.Errorf("git = %+v, want an object with the labels table", git)
+	}
+}
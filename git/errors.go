@@ -0,0 +1,46 @@
+package git
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+var (
+	ErrGitNotFound = errors.New("git executable not found")
+	ErrNotARepo    = errors.New("not a git repository")
+	ErrNoHistory   = errors.New("no git history for file")
+)
+
+// CommandError is returned when a git invocation fails, it keeps the message of the
+// underlying error and matches Kind with errors.Is when the failure was recognized
+type CommandError struct {
+	Err  error
+	Kind error
+}
+
+func (e *CommandError) Error() string { return e.Err.Error() }
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+func (e *CommandError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// classifies the error of a finished git command
+func commandError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var kind error
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		kind = ErrGitNotFound
+	case errors.As(err, &exitErr) && strings.Contains(strings.ToLower(string(exitErr.Stderr)), "not a git repository"):
+		kind = ErrNotARepo
+	}
+
+	return &CommandError{Err: err, Kind: kind}
+}
@@ -0,0 +1,38 @@
+package git
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	t.Run("not a repo", func(t *testing.T) {
+		tempRepo(t) // skips without git
+		dir := t.TempDir()
+		t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+
+		info := detectRepoInfo(dir)
+		if info.IsRepo || !errors.Is(info.Err, ErrNotARepo) {
+			t.Errorf("err = %v, want ErrNotARepo", info.Err)
+		}
+	})
+
+	t.Run("git not found", func(t *testing.T) {
+		t.Setenv("PATH", "")
+
+		info := detectRepoInfo(t.TempDir())
+		if !errors.Is(info.Err, ErrGitNotFound) {
+			t.Errorf("err = %v, want ErrGitNotFound", info.Err)
+		}
+	})
+
+	t.Run("no history", func(t *testing.T) {
+		dir := tempRepo(t)
+		commit(t, dir, "a.c", "one\n", "add a")
+
+		if _, err := GetFileInfo(dir, "missing.c"); !errors.Is(err, ErrNoHistory) {
+			t.Errorf("err = %v, want ErrNoHistory", err)
+		}
+	})
+}
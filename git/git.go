@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -17,11 +18,24 @@ type FileInfo struct {
 	LastAuthorEmail   string
 	Authors           []Author
 	TotalCommits      int
+	// only filled in by GetChurn
+	Insertions int
+	Deletions  int
+	// only filled in by GetRecentCommits, newest first
+	Recent []Commit
+}
+
+type Commit struct {
+	Hash    string
+	Date    string
+	Subject string
 }
 
 type Author struct {
 	Name  string
 	Email string
+	// GitHub login, only set when resolved through GitHubResolver
+	Login string
 }
 
 type RepoInfo struct {
@@ -32,43 +46,103 @@ type RepoInfo struct {
 	RepoName      string
 	CurrentBranch string
 	GitRoot       string
+	// why IsRepo is false, matches ErrNotARepo or ErrGitNotFound with errors.Is
+	Err error
 }
 
 var (
-	repoInfoCache *RepoInfo
-	repoInfoOnce  sync.Once
+	httpsRe  = regexp.MustCompile(`https?://([^/]+)/([^/]+)/([^/]+?)(?:\.git)?$`)
+	sshRe    = regexp.MustCompile(`git@([^:]+):([^/]+)/([^/]+?)(?:\.git)?$`)
+	authorRe = regexp.MustCompile(`^\s*\d+\s+(.+?)\s+<(.+?)>$`)
+	identRe  = regexp.MustCompile(`^(.+?)\s*<(.+?)>$`)
+)
+
+// repo info per scanned path, detected once as it runs several git commands
+var (
+	repoInfoMu    sync.Mutex
+	repoInfoCache = make(map[string]*RepoInfo)
 )
 
+// bounds the number of git processes running at once, independent of how many
+// goroutines ask for git metadata
+var gitSem = make(chan struct{}, 4)
+
+// SetMaxConcurrent changes how many git processes may run at once, call it before any
+// git function runs, values below 1 are treated as 1
+func SetMaxConcurrent(n int) {
+	gitSem = make(chan struct{}, max(n, 1))
+}
+
+// disables every function building links to providers or avatar services
+var offline bool
+
+// SetOffline turns off URL generation, the URL functions return "" so the output doesn't
+// reference any external service
+func SetOffline(enabled bool) {
+	offline = enabled
+}
+
+// placeholder of the date reported for the last commit, %ad is the author date
+var datePlaceholder = "%ad"
+
+// SetDateSource picks the date reported for the last commit, "committer" uses the committer
+// date which reflects when rebased or cherry-picked changes landed, anything else the author date
+func SetDateSource(source string) {
+	if source == "committer" {
+		datePlaceholder = "%cd"
+	} else {
+		datePlaceholder = "%ad"
+	}
+}
+
+// runs git commands, replaced in tests
+var runCmd = (*exec.Cmd).Output
+
+func output(cmd *exec.Cmd) ([]byte, error) {
+	// release the semaphore that was acquired even if SetMaxConcurrent replaces it meanwhile
+	sem := gitSem
+	sem <- struct{}{}
+	defer func() { <-sem }()
+
+	return runCmd(cmd)
+}
+
 func GetRepoInfo(repoPath string) *RepoInfo {
-	repoInfoOnce.Do(func() {
-		repoInfoCache = detectRepoInfo(repoPath)
-	})
-	return repoInfoCache
+	repoInfoMu.Lock()
+	defer repoInfoMu.Unlock()
+
+	info, ok := repoInfoCache[repoPath]
+	if !ok {
+		info = detectRepoInfo(repoPath)
+		repoInfoCache[repoPath] = info
+	}
+	return info
 }
 
 func detectRepoInfo(repoPath string) *RepoInfo {
 	info := &RepoInfo{}
 
 	cmd := exec.Command("git", "-C", repoPath, "rev-parse", "--git-dir")
-	if err := cmd.Run(); err != nil {
+	if _, err := output(cmd); err != nil {
+		info.Err = commandError(err)
 		return info
 	}
 	info.IsRepo = true
 
 	cmd = exec.Command("git", "-C", repoPath, "rev-parse", "--show-toplevel")
-	if out, err := cmd.Output(); err == nil {
+	if out, err := output(cmd); err == nil {
 		info.GitRoot = strings.TrimSpace(string(out))
 	} else {
 		info.GitRoot = repoPath
 	}
 
 	cmd = exec.Command("git", "-C", repoPath, "rev-parse", "--abbrev-ref", "HEAD")
-	if out, err := cmd.Output(); err == nil {
+	if out, err := output(cmd); err == nil {
 		info.CurrentBranch = strings.TrimSpace(string(out))
 	}
 
 	cmd = exec.Command("git", "-C", repoPath, "config", "--get", "remote.origin.url")
-	out, err := cmd.Output()
+	out, err := output(cmd)
 	if err != nil {
 		return info
 	}
@@ -80,7 +154,6 @@ func detectRepoInfo(repoPath string) *RepoInfo {
 }
 
 func parseRemoteURL(url string) (provider, owner, repo string) {
-	httpsRe := regexp.MustCompile(`https?://([^/]+)/([^/]+)/([^/]+?)(?:\.git)?$`)
 	if matches := httpsRe.FindStringSubmatch(url); len(matches) == 4 {
 		host := matches[1]
 		owner = matches[2]
@@ -99,7 +172,6 @@ func parseRemoteURL(url string) (provider, owner, repo string) {
 	}
 
 	// Handle SSH URLs (git@github.com:user/repo.git)
-	sshRe := regexp.MustCompile(`git@([^:]+):([^/]+)/([^/]+?)(?:\.git)?$`)
 	if matches := sshRe.FindStringSubmatch(url); len(matches) == 4 {
 		host := matches[1]
 		owner = matches[2]
@@ -121,21 +193,27 @@ func parseRemoteURL(url string) (provider, owner, repo string) {
 }
 
 func GetFileInfo(repoPath, filePath string) (*FileInfo, error) {
+	return GetFileInfoAt(repoPath, "HEAD", filePath)
+}
+
+// same as GetFileInfo but only considers history reachable from ref
+func GetFileInfoAt(repoPath, ref, filePath string) (*FileInfo, error) {
 	info := &FileInfo{}
 
 	cmd := exec.Command("git", "-C", repoPath, "log", "-1",
-		"--format=%H|%an|%ae|%ad|%s", "--date=short", "--", filePath)
-	out, err := cmd.Output()
+		"--format=%H%x00%aN%x00%aE%x00"+datePlaceholder+"%x00%s", "--date=short", ref, "--", filePath)
+	out, err := output(cmd)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last commit: %w", err)
+		return nil, fmt.Errorf("failed to get last commit: %w", commandError(err))
 	}
 
 	if len(out) == 0 {
-		return nil, fmt.Errorf("no git history for file")
+		return nil, ErrNoHistory
 	}
 
-	parts := strings.Split(strings.TrimSpace(string(out)), "|")
-	if len(parts) >= 5 {
+	// NUL separated since names and subjects can contain any printable character
+	parts := strings.SplitN(strings.TrimSpace(string(out)), "\x00", 5)
+	if len(parts) == 5 {
 		info.LastCommitHash = parts[0]
 		info.LastAuthorName = parts[1]
 		info.LastAuthorEmail = parts[2]
@@ -143,39 +221,173 @@ func GetFileInfo(repoPath, filePath string) (*FileInfo, error) {
 		info.LastCommitMessage = parts[4]
 	}
 
-	cmd = exec.Command("git", "-C", repoPath, "log", "--follow", "--oneline", "--", filePath)
-	out, err = cmd.Output()
+	cmd = exec.Command("git", "-C", repoPath, "log", "--follow", "--oneline", ref, "--", filePath)
+	out, err = output(cmd)
 	if err == nil {
 		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
 		info.TotalCommits = len(lines)
 	}
 
 	// git will fail silently here without specifiying "HEAD" since there is not tty attached, stupid default behaviour
-	cmd = exec.Command("git", "-C", repoPath, "shortlog", "-sne", "--follow", "HEAD", "--", filePath)
-	out, err = cmd.Output()
+	cmd = exec.Command("git", "-C", repoPath, "shortlog", "-sne", "--follow", ref, "--", filePath)
+	out, err = output(cmd)
 	if err == nil {
-		authorMap := make(map[string]Author)
+		// shortlog -n orders by commit count, keep that order so Authors[0] is the top contributor
+		seen := make(map[string]bool)
 		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-
-		authorRe := regexp.MustCompile(`^\s*\d+\s+(.+?)\s+<(.+?)>$`)
 		for _, line := range lines {
 			if matches := authorRe.FindStringSubmatch(line); len(matches) == 3 {
 				name := strings.TrimSpace(matches[1])
 				email := strings.TrimSpace(matches[2])
-				authorMap[email] = Author{Name: name, Email: email}
+				if seen[email] {
+					continue
+				}
+				seen[email] = true
+				info.Authors = append(info.Authors, Author{Name: name, Email: email})
 			}
 		}
+	}
+
+	return info, nil
+}
+
+// GetRecentCommits returns the last n commits touching a file, newest first
+func GetRecentCommits(repoPath, ref, filePath string, n int) ([]Commit, error) {
+	cmd := exec.Command("git", "-C", repoPath, "log", "-n", strconv.Itoa(n), "--follow",
+		"--format=%H%x00"+datePlaceholder+"%x00%s", "--date=short", ref, "--", filePath)
+	out, err := output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent commits: %w", commandError(err))
+	}
+
+	var commits []Commit
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.SplitN(line, "\x00", 3)
+		if len(parts) == 3 {
+			commits = append(commits, Commit{Hash: parts[0], Date: parts[1], Subject: parts[2]})
+		}
+	}
+
+	return commits, nil
+}
+
+// GetChurn sums the lines added and removed over the whole history of a file
+func GetChurn(repoPath, ref, filePath string) (insertions, deletions int, err error) {
+	cmd := exec.Command("git", "-C", repoPath, "log", "--numstat", "--format=", "--follow", ref, "--", filePath)
+	out, err := output(cmd)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get churn: %w", commandError(err))
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+
+		// binary files report "-" instead of line counts
+		added, errA := strconv.Atoi(fields[0])
+		removed, errR := strconv.Atoi(fields[1])
+		if errA != nil || errR != nil {
+			continue
+		}
+
+		insertions += added
+		deletions += removed
+	}
+
+	return insertions, deletions, nil
+}
 
-		for _, author := range authorMap {
-			info.Authors = append(info.Authors, author)
+// NormalizeAuthors merges duplicate identities, aliases maps an email to the canonical identity
+// as "Name <email>" or just "Name", on top of that authors sharing an email or a case insensitive
+// name are folded into the first one, which shortlog ordering makes the top contributor
+func NormalizeAuthors(authors []Author, aliases map[string]string) []Author {
+	var merged []Author
+	seen := make(map[string]bool)
+	for _, a := range authors {
+		a = CanonicalAuthor(a, aliases)
+
+		email := strings.ToLower(a.Email)
+		name := "name:" + strings.ToLower(a.Name)
+		if seen[email] || seen[name] {
+			continue
 		}
+		seen[email] = true
+		seen[name] = true
+		merged = append(merged, a)
 	}
 
-	return info, nil
+	return merged
+}
+
+// CanonicalAuthor applies the alias of the author's email if there is one
+func CanonicalAuthor(a Author, aliases map[string]string) Author {
+	for email, ident := range aliases {
+		if !strings.EqualFold(email, a.Email) {
+			continue
+		}
+
+		if m := identRe.FindStringSubmatch(strings.TrimSpace(ident)); m != nil {
+			a.Name, a.Email = m[1], m[2]
+		} else if ident != "" {
+			a.Name = strings.TrimSpace(ident)
+		}
+		break
+	}
+
+	return a
+}
+
+// lists every file tracked at ref, paths are relative to the repository root
+func ListFilesAt(repoPath, ref string) ([]string, error) {
+	cmd := exec.Command("git", "-C", repoPath, "ls-tree", "-r", "-z", "--name-only", ref)
+	out, err := output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files at %s: %w", ref, commandError(err))
+	}
+
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+
+	return files, nil
+}
+
+// lists every file in the index of the work tree, paths are relative to the repository root
+func ListTrackedFiles(repoPath string) ([]string, error) {
+	cmd := exec.Command("git", "-C", repoPath, "ls-files", "-z")
+	out, err := output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tracked files: %w", commandError(err))
+	}
+
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+
+	return files, nil
+}
+
+// reads the content of filePath (relative to the repository root) at ref
+func ReadFileAt(repoPath, ref, filePath string) ([]byte, error) {
+	cmd := exec.Command("git", "-C", repoPath, "show", ref+":"+filePath)
+	out, err := output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at %s: %w", filePath, ref, commandError(err))
+	}
+
+	return out, nil
 }
 
 func GetCommitURL(repoInfo *RepoInfo, commitHash string) string {
-	if repoInfo.Provider == "unknown" || repoInfo.RepoOwner == "" || repoInfo.RepoName == "" {
+	if offline || repoInfo.Provider == "unknown" || repoInfo.RepoOwner == "" || repoInfo.RepoName == "" {
 		return ""
 	}
 
@@ -194,9 +406,58 @@ func GetCommitURL(repoInfo *RepoInfo, commitHash string) string {
 	return ""
 }
 
+// resolves a tag or branch to its web URL
+func GetRefURL(repoInfo *RepoInfo, ref string) string {
+	if offline || repoInfo.Provider == "unknown" || repoInfo.RepoOwner == "" || repoInfo.RepoName == "" {
+		return ""
+	}
+
+	switch repoInfo.Provider {
+	case "github":
+		return fmt.Sprintf("https://github.com/%s/%s/tree/%s",
+			repoInfo.RepoOwner, repoInfo.RepoName, ref)
+	case "gitlab":
+		return fmt.Sprintf("https://gitlab.com/%s/%s/-/tree/%s",
+			repoInfo.RepoOwner, repoInfo.RepoName, ref)
+	case "gitea":
+		return fmt.Sprintf("https://%s/%s/%s/src/%s",
+			"gitea.com", repoInfo.RepoOwner, repoInfo.RepoName, ref)
+	}
+
+	return ""
+}
+
+// builds a URL comparing two refs, base being the older one
+func GetCompareURL(repoInfo *RepoInfo, base, head string) string {
+	if offline || repoInfo.Provider == "unknown" || repoInfo.RepoOwner == "" || repoInfo.RepoName == "" {
+		return ""
+	}
+
+	switch repoInfo.Provider {
+	case "github":
+		return fmt.Sprintf("https://github.com/%s/%s/compare/%s...%s",
+			repoInfo.RepoOwner, repoInfo.RepoName, base, head)
+	case "gitlab":
+		return fmt.Sprintf("https://gitlab.com/%s/%s/-/compare/%s...%s",
+			repoInfo.RepoOwner, repoInfo.RepoName, base, head)
+	case "gitea":
+		return fmt.Sprintf("https://%s/%s/%s/compare/%s...%s",
+			"gitea.com", repoInfo.RepoOwner, repoInfo.RepoName, base, head)
+	}
+
+	return ""
+}
+
 func GetAvatarURL(repoInfo *RepoInfo, author Author, size int) string {
+	if offline {
+		return ""
+	}
+
 	switch repoInfo.Provider {
 	case "github":
+		if author.Login != "" {
+			return fmt.Sprintf("https://github.com/%s.png?size=%d", author.Login, size)
+		}
 		if strings.HasSuffix(author.Email, "@users.noreply.github.com") {
 			parts := strings.Split(author.Email, "@")
 			if len(parts) > 0 {
@@ -224,7 +485,7 @@ func getGravatarURL(email string, size int) string {
 }
 
 func GetFileURL(repoInfo *RepoInfo, commitHash, filePath string) string {
-	if repoInfo.Provider == "unknown" || repoInfo.RepoOwner == "" || repoInfo.RepoName == "" {
+	if offline || repoInfo.Provider == "unknown" || repoInfo.RepoOwner == "" || repoInfo.RepoName == "" {
 		return ""
 	}
 
@@ -239,3 +500,21 @@ func GetFileURL(repoInfo *RepoInfo, commitHash, filePath string) string {
 
 	return ""
 }
+
+// GetRawFileURL links to the raw content of filePath at commitHash, e.g. for downloading snippets
+func GetRawFileURL(repoInfo *RepoInfo, commitHash, filePath string) string {
+	if offline || repoInfo.Provider == "unknown" || repoInfo.RepoOwner == "" || repoInfo.RepoName == "" {
+		return ""
+	}
+
+	switch repoInfo.Provider {
+	case "github":
+		return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s",
+			repoInfo.RepoOwner, repoInfo.RepoName, commitHash, filePath)
+	case "gitlab":
+		return fmt.Sprintf("https://gitlab.com/%s/%s/-/raw/%s/%s",
+			repoInfo.RepoOwner, repoInfo.RepoName, commitHash, filePath)
+	}
+
+	return ""
+}
@@ -0,0 +1,263 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrent(t *testing.T) {
+	saved := runCmd
+	t.Cleanup(func() {
+		runCmd = saved
+		SetMaxConcurrent(4)
+	})
+
+	var running, peak atomic.Int64
+	runCmd = func(cmd *exec.Cmd) ([]byte, error) {
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(2 * time.Millisecond)
+		running.Add(-1)
+		return nil, nil
+	}
+
+	SetMaxConcurrent(3)
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output(exec.Command("git", "--version"))
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > 3 {
+		t.Errorf("%d git processes ran at once, want at most 3", got)
+	}
+	if got := peak.Load(); got < 2 {
+		t.Errorf("peak concurrency %d, the calls should run in parallel", got)
+	}
+}
+
+func TestSetMaxConcurrentWhileRunning(t *testing.T) {
+	saved := runCmd
+	t.Cleanup(func() {
+		runCmd = saved
+		SetMaxConcurrent(4)
+	})
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	runCmd = func(cmd *exec.Cmd) ([]byte, error) {
+		started <- struct{}{}
+		<-release
+		return nil, nil
+	}
+
+	SetMaxConcurrent(1)
+	done := make(chan struct{})
+	go func() {
+		output(exec.Command("git", "--version"))
+		close(done)
+	}()
+	<-started
+
+	// the running call must release the semaphore it acquired, not the new one
+	SetMaxConcurrent(1)
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("output blocked releasing a semaphore it never acquired")
+	}
+}
+
+func repoOf(provider string) *RepoInfo {
+	return &RepoInfo{IsRepo: true, Provider: provider, RepoOwner: "acme", RepoName: "widgets"}
+}
+
+func TestGetCompareURL(t *testing.T) {
+	for provider, want := range map[string]string{
+		"github":  "https://github.com/acme/widgets/compare/v1.0.0...v1.1.0",
+		"gitlab":  "https://gitlab.com/acme/widgets/-/compare/v1.0.0...v1.1.0",
+		"gitea":   "https://gitea.com/acme/widgets/compare/v1.0.0...v1.1.0",
+		"unknown": "",
+	} {
+		if got := GetCompareURL(repoOf(provider), "v1.0.0", "v1.1.0"); got != want {
+			t.Errorf("%s: GetCompareURL = %q, want %q", provider, got, want)
+		}
+	}
+}
+
+func TestGetRefURL(t *testing.T) {
+	for provider, want := range map[string]string{
+		"github": "https://github.com/acme/widgets/tree/v1.0.0",
+		"gitlab": "https://gitlab.com/acme/widgets/-/tree/v1.0.0",
+		"gitea":  "https://gitea.com/acme/widgets/src/v1.0.0",
+	} {
+		if got := GetRefURL(repoOf(provider), "v1.0.0"); got != want {
+			t.Errorf("%s: GetRefURL = %q, want %q", provider, got, want)
+		}
+	}
+}
+
+func TestGetRawFileURL(t *testing.T) {
+	for provider, want := range map[string]string{
+		"github":  "https://raw.githubusercontent.com/acme/widgets/abc123/src/a.c",
+		"gitlab":  "https://gitlab.com/acme/widgets/-/raw/abc123/src/a.c",
+		"unknown": "",
+	} {
+		if got := GetRawFileURL(repoOf(provider), "abc123", "src/a.c"); got != want {
+			t.Errorf("%s: GetRawFileURL = %q, want %q", provider, got, want)
+		}
+	}
+}
+
+// creates an empty repository, commit adds its files to it
+func tempRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	gitRun(t, dir, "init", "-q", "-b", "main")
+	return dir
+}
+
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com",
+		"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com",
+		"GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func commit(t *testing.T, dir, name, content, message string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-q", "-m", message)
+}
+
+func TestGetChurn(t *testing.T) {
+	dir := tempRepo(t)
+	commit(t, dir, "a.c", "one\ntwo\nthree\n", "add a")        // +3
+	commit(t, dir, "a.c", "one\n2\nthree\nfour\n", "change a") // +2 -1
+	commit(t, dir, "b.c", "other\n", "add b")                  // not a.c
+	commit(t, dir, "a.c", "one\n", "shrink a")                 // -3
+
+	ins, del, err := GetChurn(dir, "HEAD", "a.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ins != 5 || del != 4 {
+		t.Errorf("churn = +%d -%d, want +5 -4", ins, del)
+	}
+}
+
+func TestMailmapMergesAuthors(t *testing.T) {
+	dir := tempRepo(t)
+	commit(t, dir, "a.c", "one\n", "add a")
+	if err := os.WriteFile(filepath.Join(dir, "a.c"), []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "commit", "-q", "-a", "-m", "change a", "--author", "jane doe <jane@old-company.com>")
+	commit(t, dir, ".mailmap", "Jane Doe <jane@example.com> <jane@old-company.com>\n", "add mailmap")
+
+	info, err := GetFileInfo(dir, "a.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Authors) != 1 || info.Authors[0] != (Author{Name: "Jane Doe", Email: "jane@example.com"}) {
+		t.Errorf("authors = %+v, want only Jane Doe <jane@example.com>", info.Authors)
+	}
+	if info.LastAuthorName != "Jane Doe" || info.LastAuthorEmail != "jane@example.com" {
+		t.Errorf("last author = %s <%s>, want the mailmapped identity", info.LastAuthorName, info.LastAuthorEmail)
+	}
+}
+
+func TestNormalizeAuthors(t *testing.T) {
+	authors := []Author{
+		{Name: "Jane Doe", Email: "jane@example.com"},
+		{Name: "jane doe", Email: "jane@home.example"},
+		{Name: "J. Doe", Email: "jd@old.example"},
+		{Name: "John Roe", Email: "john@example.com"},
+	}
+	aliases := map[string]string{"JD@old.example": "Jane Doe <jane@example.com>"}
+
+	want := []Author{
+		{Name: "Jane Doe", Email: "jane@example.com"},
+		{Name: "John Roe", Email: "john@example.com"},
+	}
+	if got := NormalizeAuthors(authors, aliases); !slices.Equal(got, want) {
+		t.Errorf("NormalizeAuthors = %+v, want %+v", got, want)
+	}
+}
+
+func TestPipeInCommitSubject(t *testing.T) {
+	dir := tempRepo(t)
+	commit(t, dir, "a.c", "one\n", "add a")
+	if err := os.WriteFile(filepath.Join(dir, "a.c"), []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "commit", "-q", "-a", "-m", "parse a|b|c tables", "--author", "Jane | Doe <jane@example.com>")
+
+	info, err := GetFileInfo(dir, "a.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.LastCommitMessage != "parse a|b|c tables" {
+		t.Errorf("subject = %q, want %q", info.LastCommitMessage, "parse a|b|c tables")
+	}
+	if info.LastAuthorName != "Jane | Doe" || info.LastAuthorEmail != "jane@example.com" {
+		t.Errorf("author = %s <%s>, want Jane | Doe <jane@example.com>", info.LastAuthorName, info.LastAuthorEmail)
+	}
+	if len(info.LastCommitHash) != 40 || info.TotalCommits != 2 {
+		t.Errorf("hash %q, %d commits, want a full hash and 2 commits", info.LastCommitHash, info.TotalCommits)
+	}
+
+	commits, err := GetRecentCommits(dir, "HEAD", "a.c", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 || commits[0].Subject != "parse a|b|c tables" {
+		t.Errorf("recent commits = %+v, want the piped subject", commits)
+	}
+}
+
+func TestDateSource(t *testing.T) {
+	dir := tempRepo(t)
+	t.Setenv("GIT_AUTHOR_DATE", "2020-01-02T12:00:00Z")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-05-06T12:00:00Z")
+	commit(t, dir, "a.c", "one\n", "add a")
+	t.Cleanup(func() { SetDateSource("author") })
+
+	for source, want := range map[string]string{"author": "2020-01-02", "committer": "2024-05-06"} {
+		SetDateSource(source)
+		info, err := GetFileInfo(dir, "a.c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.LastCommitDate != want {
+			t.Errorf("%s: date = %s, want %s", source, info.LastCommitDate, want)
+		}
+	}
+}
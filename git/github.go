@@ -0,0 +1,87 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitHubResolver looks up the GitHub login of commit authors through the REST API,
+// used for authors with a regular email that the noreply address check can't map
+type GitHubResolver struct {
+	Token   string
+	BaseURL string
+	Client  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func NewGitHubResolver(token string) *GitHubResolver {
+	return &GitHubResolver{
+		Token:   token,
+		BaseURL: "https://api.github.com",
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		cache:   make(map[string]string),
+	}
+}
+
+// Login returns the GitHub login of the author of the latest commit by email in the repository,
+// results including failures are cached so every email costs at most one request
+func (r *GitHubResolver) Login(repoInfo *RepoInfo, email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if login, ok := r.cache[email]; ok {
+		return login, nil
+	}
+
+	login, err := r.lookup(repoInfo, email)
+	r.cache[email] = login
+	return login, err
+}
+
+func (r *GitHubResolver) lookup(repoInfo *RepoInfo, email string) (string, error) {
+	// the author filter of the commits endpoint accepts emails, unlike user search it also
+	// matches users that keep their email private
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/commits?author=%s&per_page=1",
+		strings.TrimSuffix(r.BaseURL, "/"), repoInfo.RepoOwner, repoInfo.RepoName, url.QueryEscape(email))
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+r.Token)
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("github api request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("github api returned %s", resp.Status)
+	}
+
+	var commits []struct {
+		Author *struct {
+			Login string `json:"login"`
+		} `json:"author"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
+		return "", fmt.Errorf("failed to decode github api response: %w", err)
+	}
+
+	if len(commits) == 0 || commits[0].Author == nil {
+		return "", nil
+	}
+
+	return commits[0].Author.Login, nil
+}
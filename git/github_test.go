@@ -0,0 +1,74 @@
+package git
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGitHubResolverLogin(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/repos/acme/widgets/commits" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want the token", got)
+		}
+
+		switch r.URL.Query().Get("author") {
+		case "jane@example.com":
+			w.Write([]byte(`[{"author": {"login": "janedoe"}}]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer srv.Close()
+
+	r := NewGitHubResolver("secret")
+	r.BaseURL = srv.URL
+	repo := &RepoInfo{IsRepo: true, Provider: "github", RepoOwner: "acme", RepoName: "widgets"}
+
+	login, err := r.Login(repo, "Jane@Example.com ")
+	if err != nil || login != "janedoe" {
+		t.Fatalf("Login = %q, %v, want janedoe", login, err)
+	}
+	if _, err := r.Login(repo, "jane@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests for one email, want the result cached", n)
+	}
+
+	avatar := GetAvatarURL(repo, Author{Email: "jane@example.com", Login: login}, 32)
+	if avatar != "https://github.com/janedoe.png?size=32" {
+		t.Errorf("avatar = %q, want the github avatar of janedoe", avatar)
+	}
+
+	unknown, err := r.Login(repo, "someone@example.com")
+	if err != nil || unknown != "" {
+		t.Errorf("Login of an unknown email = %q, %v, want no login", unknown, err)
+	}
+	if avatar := GetAvatarURL(repo, Author{Email: "someone@example.com"}, 32); !strings.Contains(avatar, "gravatar.com") {
+		t.Errorf("avatar = %q, want the gravatar fallback", avatar)
+	}
+}
+
+func TestGitHubResolverError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	r := NewGitHubResolver("secret")
+	r.BaseURL = srv.URL
+	repo := &RepoInfo{IsRepo: true, Provider: "github", RepoOwner: "acme", RepoName: "widgets"}
+
+	if login, err := r.Login(repo, "jane@example.com"); err == nil || login != "" {
+		t.Errorf("Login = %q, %v, want an error", login, err)
+	}
+}
@@ -11,16 +11,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"runtime/pprof"
+	"slices"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/kociumba/kdoc/config"
 	"github.com/kociumba/kdoc/git"
+	"github.com/kociumba/kdoc/output"
 	"github.com/kociumba/kdoc/parser"
+	"github.com/kociumba/kdoc/report"
 	"github.com/urfave/cli/v3"
 )
 
@@ -44,6 +55,44 @@ func matchesExclude(path string, excludes []string) bool {
 	return false
 }
 
+// returns the language configured in include_files for a path relative to the scan root
+func includedLang(rel string) (string, bool) {
+	for pattern, lang := range config.CFG.IncludeFiles {
+		if matched, _ := doublestar.Match(pattern, rel); matched {
+			return lang, true
+		}
+	}
+
+	return "", false
+}
+
+// dot-prefixed entries are skipped when skip_hidden is set and .git always is,
+// hidden directories an include_files pattern points into are still walked
+func skipHidden(rel string, isDir bool) bool {
+	name := pathpkg.Base(rel)
+	if name == ".git" {
+		return true
+	}
+
+	if !config.CFG.SkipHidden || !strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	if isDir {
+		for pattern := range config.CFG.IncludeFiles {
+			if strings.HasPrefix(pattern, rel+"/") {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func isPassthrough(ext string) bool {
+	return slices.Contains(config.CFG.PassthroughExtensions, ext)
+}
+
 func collectFiles(scan_root string, excludes []string, ext_to_lang map[string]string) []string {
 	var files []string
 	err := filepath.WalkDir(scan_root, func(path string, d os.DirEntry, err error) error {
@@ -53,12 +102,29 @@ func collectFiles(scan_root string, excludes []string, ext_to_lang map[string]st
 
 		relPath, err := filepath.Rel(scan_root, path)
 		if err != nil {
-			log.Printf("Error getting relative path for %s: %v", path, err)
+			report.Warnf("Error getting relative path for %s: %v", path, err)
 			return nil
 		}
 
 		normPath := filepath.ToSlash(relPath)
 
+		if normPath != "." && skipHidden(normPath, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			if _, ok := includedLang(normPath); !ok {
+				return nil
+			}
+		}
+
+		// explicitly included files win over the exclusion patterns, directories don't
+		if !d.IsDir() {
+			if _, ok := includedLang(normPath); ok {
+				files = append(files, path)
+				return nil
+			}
+		}
+
 		if matchesExclude(normPath, excludes) {
 			if d.IsDir() {
 				return filepath.SkipDir
@@ -72,34 +138,304 @@ func collectFiles(scan_root string, excludes []string, ext_to_lang map[string]st
 		}
 
 		ext := filepath.Ext(path)
-		if _, ok := ext_to_lang[ext]; ok {
+		if _, ok := ext_to_lang[ext]; ok || isPassthrough(ext) {
 			files = append(files, path)
 		}
 
 		return nil
 	})
 	if err != nil {
-		log.Printf("Walk error: %v", err)
+		report.Warnf("Walk error: %v", err)
 	}
 
 	return files
 }
 
+// like collectFiles but lists the files tracked at a git ref instead of walking the working tree
+func collectFilesAt(git_root, ref, scan_root string, excludes []string, ext_to_lang map[string]string) ([]string, error) {
+	tracked, err := git.ListFilesAt(git_root, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range tracked {
+		path := filepath.Join(git_root, filepath.FromSlash(name))
+		rel, ok := relInside(scan_root, path)
+		if !ok {
+			continue
+		}
+
+		if _, ok := includedLang(filepath.ToSlash(rel)); ok {
+			files = append(files, path)
+			continue
+		}
+
+		// the walk skips excluded directories, so every parent has to be checked as well
+		excluded := false
+		for dir := filepath.ToSlash(rel); dir != "." && dir != "/"; dir = pathpkg.Dir(dir) {
+			if matchesExclude(dir, excludes) || skipHidden(dir, dir != filepath.ToSlash(rel)) {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			continue
+		}
+
+		ext := filepath.Ext(path)
+		if _, ok := ext_to_lang[ext]; ok || isPassthrough(ext) {
+			files = append(files, path)
+		}
+	}
+
+	return files, nil
+}
+
+// drops the files git doesn't track, outside of a repository every file is kept
+func trackedOnly(repoInfo *git.RepoInfo, scan_root string, files []string) ([]string, error) {
+	if repoInfo == nil {
+		repoInfo = git.GetRepoInfo(scan_root)
+	}
+	if !repoInfo.IsRepo {
+		return files, nil
+	}
+
+	list, err := git.ListTrackedFiles(repoInfo.GitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool, len(list))
+	for _, name := range list {
+		tracked[name] = true
+	}
+
+	return slices.DeleteFunc(files, func(path string) bool {
+		rel, ok := relInside(repoInfo.GitRoot, path)
+		return !ok || !tracked[filepath.ToSlash(rel)]
+	}), nil
+}
+
+// returns path relative to base, only if path is inside base
+func relInside(base, path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return rel, true
+}
+
+// with flat_output the directories of the relative path are folded into the file name,
+// so sub/util.h becomes sub_util.md and never collides with util.h
+func flatten(rel string) string {
+	if !config.CFG.FlatOutput {
+		return rel
+	}
+
+	return strings.ReplaceAll(filepath.ToSlash(rel), "/", "_")
+}
+
+// applies output_case to a path relative to the output root, "lower" lowercases it and "kebab"
+// also splits camelCase words and replaces underscores and spaces with dashes
+func outputCase(rel string) string {
+	switch config.CFG.OutputCase {
+	case "lower":
+		return strings.ToLower(rel)
+	case "kebab":
+		var sb strings.Builder
+		var prev rune
+		for _, r := range rel {
+			switch {
+			case r == '_' || r == ' ':
+				r = '-'
+			case unicode.IsUpper(r):
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+					sb.WriteRune('-')
+				}
+				r = unicode.ToLower(r)
+			}
+			sb.WriteRune(r)
+			prev = r
+		}
+		return sb.String()
+	}
+
+	return rel
+}
+
 func outputFilename(scan_root, file_path, out_path, ext string) string {
 	rel, _ := filepath.Rel(scan_root, file_path)
 	rel_no_ext := strings.TrimSuffix(rel, ext)
-	out_rel := filepath.Join(out_path, rel_no_ext+".md")
+	out_rel := filepath.Join(out_path, outputCase(flatten(rel_no_ext))+".md")
 	return filepath.ToSlash(out_rel)
 }
 
+// passthrough files keep their original name, everything else is mapped to a .md page
+func docFilename(scan_root string, f *parser.File, out_path string) string {
+	if f.Passthrough {
+		rel, _ := filepath.Rel(scan_root, f.Path)
+		return filepath.ToSlash(filepath.Join(out_path, outputCase(flatten(rel))))
+	}
+
+	return outputFilename(scan_root, f.Path, out_path, filepath.Ext(f.Path))
+}
+
+// reports files mapped to the same page, which output_case can introduce for names that
+// only differ in case or word separators and flat_output for paths that only differ in
+// "/" and "_", the later file overwrites the earlier one
+func warnCollisions(p *parser.Parser, scan_root string) {
+	seen := make(map[string]string)
+	for i := range p.Files {
+		page := docFilename(scan_root, &p.Files[i], "")
+		if first, ok := seen[page]; ok {
+			report.Warnf("Warning: %s and %s are both written to %s", first, p.Files[i].Path, page)
+			continue
+		}
+		seen[page] = p.Files[i].Path
+	}
+}
+
+// fills in File.Related, "directory" relates files in the same source directory
+// and "contributor" relates files sharing the same top git contributor
+func findRelated(p *parser.Parser, scan_root, mode string) {
+	key := func(f *parser.File) string {
+		switch mode {
+		case "directory":
+			return filepath.Dir(f.Path)
+		case "contributor":
+			if f.GitInfo != nil && len(f.GitInfo.Authors) > 0 {
+				return f.GitInfo.Authors[0].Email
+			}
+		}
+
+		return ""
+	}
+
+	if mode != "directory" && mode != "contributor" {
+		report.Warnf("Unknown related_files mode %q, expected 'directory' or 'contributor'", mode)
+		return
+	}
+
+	for i := range p.Files {
+		f := &p.Files[i]
+		k := key(f)
+		if k == "" || f.Passthrough {
+			continue
+		}
+
+		fromDir := filepath.Dir(docFilename(scan_root, f, ""))
+		for j := range p.Files {
+			other := &p.Files[j]
+			if i == j || other.Passthrough || key(other) != k {
+				continue
+			}
+
+			link, err := filepath.Rel(fromDir, docFilename(scan_root, other, ""))
+			if err != nil {
+				continue
+			}
+
+			name, _ := filepath.Rel(scan_root, other.Path)
+			f.Related = append(f.Related, parser.RelatedFile{
+				Name: filepath.ToSlash(name),
+				Link: filepath.ToSlash(link),
+			})
+		}
+	}
+}
+
 var config_path string
 
+// dirConfigs resolves per directory kdoc.toml overrides, the nearest ancestor config
+// of a file wins and is merged on top of the root config
+type dirConfigs struct {
+	scan_root string
+	cache     map[string]*config.Config
+}
+
+func newDirConfigs(scan_root string) *dirConfigs {
+	return &dirConfigs{scan_root: scan_root, cache: make(map[string]*config.Config)}
+}
+
+func (d *dirConfigs) forFile(path string) *config.Config {
+	return d.forDir(filepath.Dir(path))
+}
+
+func (d *dirConfigs) forDir(dir string) *config.Config {
+	if cfg, ok := d.cache[dir]; ok {
+		return cfg
+	}
+
+	cfg := &config.CFG
+	if _, inside := relInside(d.scan_root, dir); inside && dir != root && dir != d.scan_root {
+		cfg = d.forDir(filepath.Dir(dir))
+	}
+
+	override := filepath.Join(dir, "kdoc.toml")
+	if dir != root && override != config_path {
+		if _, err := os.Stat(override); err == nil {
+			merged, ignored, err := config.LoadOverride(override, *cfg)
+			if err != nil {
+				report.Warnf("Error loading %s: %v", override, err)
+			} else {
+				if len(ignored) > 0 {
+					report.Warnf("Warning: %s sets %s which only apply in the root config, per directory configs support %s",
+						override, strings.Join(ignored, ", "), strings.Join(config.DirectoryKeys, ", "))
+				}
+				cfg = &merged
+			}
+		}
+	}
+
+	d.cache[dir] = cfg
+	return cfg
+}
+
+// relative config paths are resolved against the directory containing kdoc.toml,
+// so running with --root gives the same results as running from inside that directory
+func resolveFromRoot(path string) string {
+	if path == "" {
+		return root
+	}
+
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+
+	return filepath.Join(root, path)
+}
+
+// walks up from dir looking for an existing kdoc.toml, the way git looks for .git
+func findConfigUpward(dir string) (string, bool) {
+	for {
+		candidate := filepath.Join(dir, "kdoc.toml")
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
 func initState(create_out bool) func(ctx context.Context, c *cli.Command) (context.Context, error) {
 	return func(ctx context.Context, c *cli.Command) (context.Context, error) {
-		out = filepath.Clean(c.String("output"))
-
 		if len(c.String("root")) != 0 {
-			root = filepath.Clean(c.String("root"))
+			var err error
+			root, err = filepath.Abs(c.String("root"))
+			if err != nil {
+				return ctx, err
+			}
 			config_path = filepath.Join(root, "kdoc.toml")
 		} else {
 			var err error
@@ -110,11 +446,24 @@ func initState(create_out bool) func(ctx context.Context, c *cli.Command) (conte
 			config_path = filepath.Join(root, "kdoc.toml")
 		}
 
+		if c.Bool("config-search-upward") {
+			if found, ok := findConfigUpward(root); ok {
+				config_path = found
+			}
+		}
+
 		if err := config.Load(config_path); err != nil {
 			return ctx, err
 		}
 
-		if create_out {
+		// an explicit --output is relative to the working dir, the configured one to the config file
+		if c.IsSet("output") {
+			out = filepath.Clean(c.String("output"))
+		} else {
+			out = resolveFromRoot(config.CFG.OutputPath)
+		}
+
+		if create_out && !output.IsZip(out) {
 			if err := os.MkdirAll(out, 0755); err != nil {
 				return ctx, err
 			}
@@ -124,172 +473,772 @@ func initState(create_out bool) func(ctx context.Context, c *cli.Command) (conte
 	}
 }
 
-var cmds = []*cli.Command{
-	{
-		Name:   "init",
-		Usage:  "initialize the default config, by default uses the working dir, use --root to overwirite",
-		Before: initState(false),
-		Action: func(ctx context.Context, c *cli.Command) error {
-			if err := config.Load(config_path); err != nil {
-				return err
-			}
+// resolves the absolute scan root and the exclude patterns, which always contain
+// the config file and unless --recurse_scan is set the output directory
+func scanTargets(c *cli.Command) (string, []string, error) {
+	scan_root, err := filepath.Abs(resolveFromRoot(config.CFG.ScanRoot))
+	if err != nil {
+		return "", nil, err
+	}
 
-			fmt.Printf("kdoc initialized succesfully in %s\n\nedit this file to configure kdoc\nor run 'kdoc generate' to build docs\n", config_path)
+	// writing the docs straight into the scan root would mix them with the sources
+	// and could overwrite .md sources or passthrough files
+	if abs_out, err := filepath.Abs(out); err == nil && abs_out == scan_root {
+		return "", nil, fmt.Errorf("output path %s is the scan root, use a subdirectory like ./docs", abs_out)
+	}
 
-			return nil
-		},
-	},
-	{
-		Name:    "generate",
-		Aliases: []string{"gen"},
-		Usage:   "uses the defined config values to generate markdown docs from found source files",
-		Before:  initState(true),
-		Action: func(ctx context.Context, c *cli.Command) error {
-			p := parser.Parser{
-				Files:        []parser.File{},
-				ElementIndex: make(map[string]string),
-			}
+	exclusions := slices.Clone(config.CFG.ScanExclusions)
+	if rel, ok := relInside(scan_root, config_path); ok {
+		exclusions = append(exclusions, rel)
+	}
+	if !c.Bool("recurse_scan") {
+		if rel, ok := relInside(scan_root, out); ok {
+			exclusions = append(exclusions, rel)
+		}
+	}
+
+	scan_excludes := []string{}
+	for _, pattern := range exclusions {
+		scan_excludes = append(scan_excludes, filepath.ToSlash(pattern))
+	}
+
+	return scan_root, scan_excludes, nil
+}
+
+// flags of the generate command, commands reusing the pipeline like serve and check
+// run it with the zero value
+type generateOptions struct {
+	ref        string
+	singleFile string
+	noIndex    bool
+	indexOnly  bool
+	dryRun     bool
+	timings    bool
+	lintOutput bool
+}
+
+func generateFlags(c *cli.Command) generateOptions {
+	return generateOptions{
+		ref:        c.String("ref"),
+		singleFile: c.String("single-file"),
+		noIndex:    c.Bool("no-index"),
+		indexOnly:  c.Bool("index-only"),
+		dryRun:     c.Bool("dry-run"),
+		timings:    c.Bool("timings"),
+		lintOutput: c.Bool("lint-output"),
+	}
+}
+
+// collects and parses every documented file under the scan root, including git metadata,
+// shared by all commands that need the parsed project
+func parseProject(c *cli.Command, opts generateOptions) (*parser.Parser, string, error) {
+	p := &parser.Parser{
+		Files:        []parser.File{},
+		ElementIndex: make(map[string]string),
+	}
 
-			wd, err := os.Getwd()
+	scan_root, scan_excludes, err := scanTargets(c)
+	if err != nil {
+		return nil, "", err
+	}
+	p.Root = scan_root
+	p.DocPath = func(f *parser.File) string {
+		return docFilename(scan_root, f, "")
+	}
+
+	// the indexes only need git when they show commit hashes or the feed lists the last commits
+	indexNeedsGit := config.CFG.IndexCommitHash || config.CFG.FeedBaseURL != ""
+	enableGit := !c.Bool("no-git") && !(opts.indexOnly && !indexNeedsGit)
+	if enableGit {
+		git.SetMaxConcurrent(config.CFG.GitMaxConcurrency)
+		git.SetDateSource(config.CFG.GitDateSource)
+		git.SetOffline(config.CFG.Offline)
+		p.RepoInfo = git.GetRepoInfo(scan_root)
+		if p.RepoInfo.IsRepo {
+			fmt.Printf("Git repository detected: %s/%s\n", p.RepoInfo.RepoOwner, p.RepoInfo.RepoName)
+		} else {
+			log.Printf("Not a git repository, skipping git metadata")
+			enableGit = false
+		}
+	}
+
+	var resolver *git.GitHubResolver
+	if enableGit && p.RepoInfo.Provider == "github" && !config.CFG.Offline {
+		if token := os.ExpandEnv(config.CFG.GitHubToken); token != "" {
+			resolver = git.NewGitHubResolver(token)
+		}
+	}
+
+	ref := opts.ref
+	readSource := parser.ReadSource
+
+	collectStart := time.Now()
+	var matchedFiles []string
+	if ref != "" {
+		if p.RepoInfo == nil || !p.RepoInfo.IsRepo {
+			return nil, "", fmt.Errorf("--ref needs a git repository and can't be combined with --no-git")
+		}
+
+		matchedFiles, err = collectFilesAt(p.RepoInfo.GitRoot, ref, scan_root, scan_excludes, config.CFG.ExtensionsToLangs)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// the card shows the documented ref instead of the checked out branch, the repo info
+		// is shared with other callers of git.GetRepoInfo so it's copied first
+		info := *p.RepoInfo
+		info.CurrentBranch = ref
+		p.RepoInfo = &info
+
+		readSource = func(path string) ([]byte, error) {
+			rel, err := filepath.Rel(p.RepoInfo.GitRoot, path)
 			if err != nil {
-				return err
+				return nil, err
 			}
-
-			scan_root := filepath.Clean(If(len(config.CFG.ScanRoot) == 0, wd, config.CFG.ScanRoot))
-			scan_root = filepath.ToSlash(scan_root)
-			scan_root, err = filepath.Abs(scan_root)
+			return git.ReadFileAt(p.RepoInfo.GitRoot, ref, filepath.ToSlash(rel))
+		}
+	} else {
+		matchedFiles = collectFiles(scan_root, scan_excludes, config.CFG.ExtensionsToLangs)
+		if config.CFG.OnlyTracked && !c.Bool("no-git") {
+			matchedFiles, err = trackedOnly(p.RepoInfo, scan_root, matchedFiles)
 			if err != nil {
-				return err
+				return nil, "", err
 			}
+		}
+	}
+	timings.collect += time.Since(collectStart)
 
-			enableGit := !c.Bool("no-git")
-			if enableGit {
-				p.RepoInfo = git.GetRepoInfo(scan_root)
-				if p.RepoInfo.IsRepo {
-					fmt.Printf("Git repository detected: %s/%s\n", p.RepoInfo.RepoOwner, p.RepoInfo.RepoName)
-				} else {
-					log.Printf("Not a git repository, skipping git metadata")
-					enableGit = false
-				}
-			}
+	totalFiles := len(matchedFiles)
+	if totalFiles == 0 {
+		return nil, "", fmt.Errorf("no files matched extensions in %s\nConfigured extensions: %v", scan_root, config.CFG.ExtensionsToLangs)
+	}
 
-			scan_excludes := []string{}
-			config.CFG.ScanExclusions = append(config.CFG.ScanExclusions, filepath.Join(scan_root, "kdoc.toml"))
-			if !c.Bool("recurse_scan") {
-				config.CFG.ScanExclusions = append(config.CFG.ScanExclusions, config.CFG.OutputPath)
-			}
+	overrides := newDirConfigs(scan_root)
+	for i, filePath := range matchedFiles {
+		ext := filepath.Ext(filePath)
+
+		displayPath, err := filepath.Rel(scan_root, filePath)
+		if err != nil {
+			displayPath = filePath
+		}
+		displayPath = filepath.ToSlash(displayPath)
 
-			for _, pattern := range config.CFG.ScanExclusions {
-				scan_excludes = append(scan_excludes, filepath.ToSlash(pattern))
+		fmt.Printf("\x1b[2K\r[%d/%d] Processing: %s", i+1, totalFiles, displayPath)
+
+		parseStart := time.Now()
+		data, err := readSource(filePath)
+		if err != nil {
+			report.Warnf("Error reading %s: %v", filePath, err)
+			continue
+		}
+
+		includeLang, included := includedLang(displayPath)
+		if !included && isPassthrough(ext) {
+			var f parser.File
+			parser.PassthroughContent(filePath, data, &f)
+			p.Files = append(p.Files, f)
+			continue
+		}
+
+		cfg := overrides.forFile(filePath)
+		lang, ok := cfg.ExtensionsToLangs[ext]
+		if included {
+			lang, ok = includeLang, true
+		}
+		if !ok {
+			continue
+		}
+
+		var f parser.File
+		f.Language = lang
+		docPrefixes := []string(cfg.DocCommentFor(lang))
+		if cfg.DocCommentAuto && !cfg.DocCommentIsRegex {
+			docPrefixes = parser.DetectDocPrefix(data, docPrefixes)
+		}
+		parser.ParseContent(filePath, data, &f, docPrefixes, cfg.IgnoreIndented)
+		timings.parse += time.Since(parseStart)
+
+		var relPath string
+		if p.RepoInfo != nil && p.RepoInfo.IsRepo && p.RepoInfo.GitRoot != "" {
+			relPath, err = filepath.Rel(p.RepoInfo.GitRoot, filePath)
+			if err != nil {
+				report.Warnf("Warning: failed to get relative path from git root: %v", err)
+				relPath, _ = filepath.Rel(scan_root, filePath)
 			}
+		} else {
+			relPath, _ = filepath.Rel(scan_root, filePath)
+		}
+
+		relPath = filepath.ToSlash(relPath)
 
-			matchedFiles := collectFiles(scan_root, scan_excludes, config.CFG.ExtensionsToLangs)
-			totalFiles := len(matchedFiles)
-			if totalFiles == 0 {
-				return fmt.Errorf("no files matched extensions in %s\nConfigured extensions: %v", scan_root, config.CFG.ExtensionsToLangs)
+		if p.RepoInfo != nil && p.RepoInfo.IsRepo && p.RepoInfo.GitRoot != "" {
+			gitStart := time.Now()
+			gitRef := If(ref != "", ref, "HEAD")
+			gitInfo, err := git.GetFileInfoAt(p.RepoInfo.GitRoot, gitRef, relPath)
+			if errors.Is(err, git.ErrNoHistory) && config.CFG.UncommittedCard {
+				f.Uncommitted = true
+			} else if err != nil {
+				report.Warnf("Warning: Could not get git info for %s: %v", filePath, err)
+			} else {
+				f.GitInfo = gitInfo
 			}
 
-			for i, filePath := range matchedFiles {
-				ext := filepath.Ext(filePath)
-				lang, ok := config.CFG.ExtensionsToLangs[ext]
-				if !ok {
-					continue
-				}
+			if f.GitInfo != nil {
+				f.GitInfo.Authors = git.NormalizeAuthors(f.GitInfo.Authors, config.CFG.AuthorAliases)
+				last := git.CanonicalAuthor(git.Author{Name: f.GitInfo.LastAuthorName, Email: f.GitInfo.LastAuthorEmail}, config.CFG.AuthorAliases)
+				f.GitInfo.LastAuthorName, f.GitInfo.LastAuthorEmail = last.Name, last.Email
+			}
 
-				displayPath, err := filepath.Rel(scan_root, filePath)
+			if f.GitInfo != nil && config.CFG.GitChurn {
+				f.GitInfo.Insertions, f.GitInfo.Deletions, err = git.GetChurn(p.RepoInfo.GitRoot, gitRef, relPath)
 				if err != nil {
-					displayPath = filePath
+					report.Warnf("Warning: Could not get churn for %s: %v", filePath, err)
 				}
-				displayPath = filepath.ToSlash(displayPath)
-
-				fmt.Printf("\x1b[2K\r[%d/%d] Processing: %s", i+1, totalFiles, displayPath)
+			}
 
-				var f parser.File
-				f.Language = lang
-				if err := parser.ParseFile(filePath, &f, config.CFG.DocComment, config.CFG.IgnoreIndented); err != nil {
-					log.Printf("Error parsing %s: %v", filePath, err)
-					continue
+			if f.GitInfo != nil && config.CFG.RecentCommits > 0 {
+				f.GitInfo.Recent, err = git.GetRecentCommits(p.RepoInfo.GitRoot, gitRef, relPath, config.CFG.RecentCommits)
+				if err != nil {
+					report.Warnf("Warning: Could not get recent commits for %s: %v", filePath, err)
 				}
+			}
 
-				var relPath string
-				if p.RepoInfo != nil && p.RepoInfo.IsRepo && p.RepoInfo.GitRoot != "" {
-					relPath, err = filepath.Rel(p.RepoInfo.GitRoot, filePath)
+			if f.GitInfo != nil && resolver != nil {
+				for j, author := range f.GitInfo.Authors {
+					login, err := resolver.Login(p.RepoInfo, author.Email)
 					if err != nil {
-						log.Printf("Warning: failed to get relative path from git root: %v", err)
-						relPath, _ = filepath.Rel(scan_root, filePath)
+						report.Warnf("Warning: Could not resolve GitHub account of %s: %v", author.Email, err)
 					}
-				} else {
-					relPath, _ = filepath.Rel(scan_root, filePath)
+					f.GitInfo.Authors[j].Login = login
 				}
+			}
+			timings.git += time.Since(gitStart)
+		}
+
+		p.Files = append(p.Files, f)
+	}
 
-				relPath = filepath.ToSlash(relPath)
+	fmt.Printf("\x1b[2K\r[%d/%d] Processing complete\n", totalFiles, totalFiles)
 
-				if p.RepoInfo != nil && p.RepoInfo.IsRepo && p.RepoInfo.GitRoot != "" {
-					gitInfo, err := git.GetFileInfo(p.RepoInfo.GitRoot, relPath)
-					if err != nil {
-						log.Printf("Warning: Could not get git info for %s: %v", filePath, err)
-					} else {
-						f.GitInfo = gitInfo
-					}
+	return p, scan_root, nil
+}
+
+// durations of the generate phases, printed by --timings
+type phaseTimings struct {
+	collect, parse, git, index, write time.Duration
+}
+
+var timings phaseTimings
+
+func (t phaseTimings) print() {
+	fmt.Println("Timings:")
+	for _, phase := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"collection", t.collect},
+		{"parsing", t.parse},
+		{"git metadata", t.git},
+		{"index building", t.index},
+		{"writing", t.write},
+	} {
+		fmt.Printf("  %-15s %s\n", phase.name, phase.d.Round(time.Microsecond))
+	}
+}
+
+// runs the whole pipeline and writes the docs, used by generate and serve
+func generate(c *cli.Command, opts generateOptions) error {
+	report.Reset()
+	timings = phaseTimings{}
+	if opts.timings {
+		defer func() { timings.print() }()
+	}
+
+	if opts.indexOnly && opts.noIndex {
+		return fmt.Errorf("--index-only and --no-index can't be used together")
+	}
+
+	// a zip archive is rewritten as a whole, it would only contain the indexes afterwards
+	if opts.indexOnly && output.IsZip(out) {
+		return fmt.Errorf("--index-only can't update the zip archive %s, regenerate it without --index-only", out)
+	}
+
+	p, scan_root, err := parseProject(c, opts)
+	if err != nil {
+		return err
+	}
+
+	if config.CFG.RelatedFiles != "" {
+		findRelated(p, scan_root, config.CFG.RelatedFiles)
+	}
+
+	// links are relative to the output root, ProcessBacklinks rebases them on the referring page,
+	// every element is also reachable qualified by its source path as [path#ID], so IDs defined in
+	// several files keep their first definition and the others can still be linked
+	linkIndex := make(map[string]string)
+	defined := make(map[string]string)
+	for _, f := range p.Files {
+		page := docFilename(scan_root, &f, "")
+		src, _ := filepath.Rel(scan_root, f.Path)
+		src = filepath.ToSlash(src)
+		for _, e := range f.Elements {
+			link := fmt.Sprintf("%s#%s", page, parser.Anchor(e.ID))
+			linkIndex[src+"#"+e.ID] = link
+
+			location := fmt.Sprintf("%s:%d", src, e.Line)
+			if first, ok := defined[e.ID]; ok {
+				if !strings.HasPrefix(first, src+":") {
+					report.Warnf("Warning: %s is defined in %s and %s, [%s] links to the first, use [%s#%s] for the other",
+						e.ID, first, location, e.ID, src, e.ID)
 				}
+				continue
+			}
+			defined[e.ID] = location
+			linkIndex[e.ID] = link
+		}
+	}
+
+	for i := range p.Files {
+		if p.Files[i].Passthrough {
+			continue
+		}
 
-				p.Files = append(p.Files, f)
+		from := docFilename(scan_root, &p.Files[i], "")
+		p.Files[i].ModuleDesc = parser.ProcessBacklinks(p.Files[i].ModuleDesc, linkIndex, from)
+		for j := range p.Files[i].Elements {
+			e := &p.Files[i].Elements[j]
+			e.Description = parser.ProcessBacklinks(e.Description, linkIndex, from)
+			e.Brief = parser.ProcessBacklinks(e.Brief, linkIndex, from)
+			e.Returns = parser.ProcessBacklinks(e.Returns, linkIndex, from)
+			for k := range e.Params {
+				e.Params[k].Description = parser.ProcessBacklinks(e.Params[k].Description, linkIndex, from)
 			}
+		}
+	}
+
+	if config.CFG.OutputCase != "preserve" || config.CFG.FlatOutput {
+		warnCollisions(p, scan_root)
+	}
+
+	storePageMetas(p, scan_root)
+
+	if opts.singleFile != "" {
+		return writeSingleFile(c, opts, p, scan_root)
+	}
+
+	var w output.Writer
+	dryRun := opts.dryRun
+	if dryRun {
+		w = output.NewMemoryWriter()
+	} else {
+		w, err = output.New(out)
+		if err != nil {
+			return err
+		}
+	}
+
+	writeStart := time.Now()
+	indexOnly := opts.indexOnly
+	lint := opts.lintOutput
+	fileIssues := make([][]parser.Issue, len(p.Files))
+	write_range := len(p.Files)
 
-			fmt.Printf("\x1b[2K\r[%d/%d] Processing complete\n", totalFiles, totalFiles)
+	// pages are generated and written by a bounded pool, the writers are safe for concurrent use
+	var (
+		wg       sync.WaitGroup
+		progress sync.Mutex
+		written  int
+	)
+	jobs := make(chan int)
+	for range max(config.CFG.WriteConcurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				f := &p.Files[i]
+				relOut := docFilename(scan_root, f, "")
 
-			linkIndex := make(map[string]string)
-			for _, f := range p.Files {
-				outFile := outputFilename(scan_root, f.Path, out, filepath.Ext(f.Path))
-				if f.ModuleDesc != "" {
+				mdContent := p.GenerateMarkdownForFile(f)
+				data := mdContent
+				if config.CFG.MergeMarkers && !f.Passthrough && !output.IsZip(out) {
+					existing, _ := os.ReadFile(filepath.Join(out, filepath.FromSlash(relOut)))
+					data = output.Merge(string(existing), mdContent)
 				}
 
-				for _, e := range f.Elements {
-					headerID := strings.ToLower(strings.ReplaceAll(e.ID, " ", "-"))
-					linkIndex[e.ID] = fmt.Sprintf("%s#%s", filepath.Base(outFile), headerID)
+				if err := w.WriteFile(relOut, []byte(data)); err != nil {
+					report.Warnf("Error writing %s: %v", relOut, err)
 				}
-			}
 
-			for i := range p.Files {
-				p.Files[i].ModuleDesc = parser.ProcessBacklinks(p.Files[i].ModuleDesc, linkIndex, config.CFG.DocComment)
-				for j := range p.Files[i].Elements {
-					p.Files[i].Elements[j].Description = parser.ProcessBacklinks(p.Files[i].Elements[j].Description, linkIndex, config.CFG.DocComment)
+				if lint && !f.Passthrough {
+					fileIssues[i] = parser.LintMarkdown(filepath.ToSlash(relOut), mdContent)
+				}
+
+				if !dryRun {
+					progress.Lock()
+					written++
+					fmt.Printf("\x1b[2K\r[%d/%d] Writing: %s", written, write_range, filepath.ToSlash(filepath.Join(out, relOut)))
+					progress.Unlock()
 				}
 			}
+		}()
+	}
+
+	if !indexOnly {
+		for i := range p.Files {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	lintIssues := slices.Concat(fileIssues...)
 
-			write_range := len(p.Files)
-			for i, f := range p.Files {
-				outFile := outputFilename(scan_root, f.Path, out, filepath.Ext(f.Path))
-				outDir := filepath.Dir(outFile)
-				if err := os.MkdirAll(outDir, 0755); err != nil {
-					log.Printf("Error creating dir %s: %v", outDir, err)
-					continue
+	timings.write += time.Since(writeStart)
+
+	if !opts.noIndex {
+		indexStart := time.Now()
+		writeIndexes(p, scan_root, w)
+		timings.index += time.Since(indexStart)
+	}
+
+	closeStart := time.Now()
+	if err := w.Close(); err != nil {
+		return err
+	}
+	timings.write += time.Since(closeStart)
+
+	if dryRun {
+		planned := w.(*output.MemoryWriter).Files
+		paths := slices.Sorted(maps.Keys(planned))
+
+		fmt.Printf("Dry run, %d files would be written:\n", len(paths))
+		for _, path := range paths {
+			fmt.Printf("  %s (%d bytes)\n", filepath.ToSlash(filepath.Join(out, path)), len(planned[path]))
+		}
+
+		if err := reportLint(lint, lintIssues); err != nil {
+			return err
+		}
+
+		return checkWarnings(c)
+	}
+
+	if indexOnly {
+		fmt.Println("Writing indexes complete")
+	} else {
+		fmt.Printf("\x1b[2K\r[%d/%d] Writing docs complete\n", write_range, write_range)
+	}
+
+	if err := reportLint(lint, lintIssues); err != nil {
+		return err
+	}
+
+	return checkWarnings(c)
+}
+
+// writes the whole project as one document instead of a page per file
+func writeSingleFile(c *cli.Command, opts generateOptions, p *parser.Parser, scan_root string) error {
+	target := opts.singleFile
+	doc := p.GenerateSingleFile("Documentation", func(f *parser.File) string {
+		return docFilename(scan_root, f, "")
+	})
+
+	if opts.dryRun {
+		fmt.Printf("Dry run, 1 file would be written:\n  %s (%d bytes)\n", filepath.ToSlash(target), len(doc))
+		return checkWarnings(c)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := output.WriteFileAtomic(target, []byte(doc)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s\n", filepath.ToSlash(target))
+	return checkWarnings(c)
+}
+
+// prints the issues found by --lint-output, failing the run if there are any
+func reportLint(lint bool, issues []parser.Issue) error {
+	if !lint {
+		return nil
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("lint found %d issues in the generated docs", len(issues))
+	}
+
+	return nil
+}
+
+func writeIndexes(p *parser.Parser, scan_root string, w output.Writer) {
+	docPath := func(f *parser.File) string {
+		return docFilename(scan_root, f, "")
+	}
+
+	if config.CFG.GenerateIndex {
+		index := []byte(p.GenerateIndex(docPath))
+		if config.CFG.IndexReadme != "" {
+			readme, err := os.ReadFile(filepath.Join(scan_root, config.CFG.IndexReadme))
+			if err != nil {
+				report.Warnf("Warning: Could not read index_readme: %v", err)
+			} else {
+				index = []byte(p.GenerateReadmeIndex(string(readme), docPath))
+			}
+		}
+		for _, name := range config.CFG.IndexFiles {
+			if err := w.WriteFile(name, index); err != nil {
+				report.Warnf("Error writing %s: %v", name, err)
+			}
+		}
+	}
+
+	if config.CFG.LanguageIndexes {
+		for _, lang := range p.Languages() {
+			name := lang + "-index.md"
+			if err := w.WriteFile(name, []byte(p.GenerateLanguageIndex(lang, docPath))); err != nil {
+				report.Warnf("Error writing %s: %v", name, err)
+			}
+		}
+	}
+
+	if config.CFG.SymbolIndex {
+		if err := w.WriteFile("symbols-index.md", []byte(p.GenerateSymbolIndex(docPath))); err != nil {
+			report.Warnf("Error writing symbols-index.md: %v", err)
+		}
+	}
+
+	if config.CFG.FeedBaseURL != "" {
+		data, err := p.GenerateFeed("Documentation", config.CFG.FeedBaseURL, docPath)
+		if err == nil {
+			err = w.WriteFile("feed.json", data)
+		}
+		if err != nil {
+			report.Warnf("Error writing feed.json: %v", err)
+		}
+	}
+
+	if config.CFG.SymbolJSON {
+		data, err := p.GenerateSymbolJSON(docPath)
+		if err == nil {
+			err = w.WriteFile("symbols.json", data)
+		}
+		if err != nil {
+			report.Warnf("Error writing symbols.json: %v", err)
+		}
+	}
+}
+
+func checkWarnings(c *cli.Command) error {
+	if n := report.Count(); n > 0 && c.Bool("warnings-as-errors") {
+		return fmt.Errorf("%d warnings reported, failing because of --warnings-as-errors", n)
+	}
+
+	return nil
+}
+
+// the subcommands of kdoc, see newApp
+func commands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:   "init",
+			Usage:  "initialize the default config, by default uses the working dir, use --root to overwirite",
+			Before: initState(false),
+			Action: func(ctx context.Context, c *cli.Command) error {
+				if err := config.Load(config_path); err != nil {
+					return err
 				}
 
-				fmt.Printf("\x1b[2K\r[%d/%d] Writing: %s", i+1, write_range, outFile)
+				fmt.Printf("kdoc initialized succesfully in %s\n\nedit this file to configure kdoc\nor run 'kdoc generate' to build docs\n", config_path)
+
+				return nil
+			},
+		},
+		{
+			Name:  "config",
+			Usage: "inspect the kdoc configuration",
+			Commands: []*cli.Command{
+				{
+					Name:  "schema",
+					Usage: "print a JSON Schema for kdoc.toml, useful for editor validation",
+					Action: func(ctx context.Context, c *cli.Command) error {
+						data, err := json.MarshalIndent(config.Schema(), "", "  ")
+						if err != nil {
+							return err
+						}
+
+						fmt.Println(string(data))
+						return nil
+					},
+				},
+				{
+					Name:   "show",
+					Usage:  "print the effective configuration after applying kdoc.toml and command line flags",
+					Before: initState(false),
+					Action: func(ctx context.Context, c *cli.Command) error {
+						cfg := config.CFG
+						if c.IsSet("output") {
+							cfg.OutputPath = out
+						}
 
-				mdContent := p.GenerateMarkdownForFile(&f)
-				if err := os.WriteFile(outFile, []byte(mdContent), 0644); err != nil {
-					log.Printf("Error writing %s: %v", outFile, err)
+						fmt.Printf("# config file: %s\n", config_path)
+						fmt.Printf("# root: %s\n", root)
+						fmt.Printf("# output: %s\n\n", out)
+						return config.Encode(os.Stdout, cfg)
+					},
+				},
+			},
+		},
+		{
+			Name:   "check",
+			Usage:  "parse the sources without writing docs and report documentation problems",
+			Before: initState(false),
+			Action: func(ctx context.Context, c *cli.Command) error {
+				p, scan_root, err := parseProject(c, generateOptions{})
+				if err != nil {
+					return err
 				}
-			}
 
-			fmt.Printf("\x1b[2K\r[%d/%d] Writing docs complete\n", write_range, write_range)
+				var issues []parser.Issue
+				for i := range p.Files {
+					if p.Files[i].Passthrough {
+						continue
+					}
 
-			return nil
+					issues = append(issues, parser.CheckSignatures(&p.Files[i])...)
+				}
+
+				for _, issue := range issues {
+					if rel, err := filepath.Rel(scan_root, issue.File); err == nil {
+						issue.File = filepath.ToSlash(rel)
+					}
+					fmt.Println(issue)
+				}
+
+				if len(issues) > 0 {
+					return fmt.Errorf("check found %d issues", len(issues))
+				}
+
+				fmt.Println("no issues found")
+				return checkWarnings(c)
+			},
+		},
+		{
+			Name:    "generate",
+			Aliases: []string{"gen"},
+			Usage:   "uses the defined config values to generate markdown docs from found source files",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "ref",
+					Usage: "generate docs from the sources at a git ref (tag, branch or commit) instead of the working tree",
+				},
+				&cli.BoolFlag{
+					Name:  "no-index",
+					Usage: "skip writing the project, language and symbol indexes",
+				},
+				&cli.BoolFlag{
+					Name:  "index-only",
+					Usage: "only write the index pages, without rewriting the file pages",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "run the full pipeline but only print the files that would be written",
+				},
+				&cli.StringFlag{
+					Name:  "single-file",
+					Usage: "write every page into this one markdown file, ordered like the index and ready for pandoc, instead of the output directory",
+				},
+				&cli.BoolFlag{
+					Name:  "timings",
+					Usage: "print how long collection, parsing, git metadata, index building and writing took",
+				},
+				&cli.BoolFlag{
+					Name:  "lint-output",
+					Usage: "check the generated docs for unbalanced code fences, broken links and duplicate anchors",
+				},
+			},
+			// a dry run must not create the output directory
+			Before: func(ctx context.Context, c *cli.Command) (context.Context, error) {
+				return initState(!c.Bool("dry-run"))(ctx, c)
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				return generate(c, generateFlags(c))
+			},
 		},
-	},
+		{
+			Name:  "serve",
+			Usage: "generate the docs and serve them over http, regenerating and reloading on source changes",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:    "port",
+					Aliases: []string{"p"},
+					Usage:   "port to serve the docs on",
+					Value:   8080,
+				},
+				&cli.BoolFlag{
+					Name:  "no-generate",
+					Usage: "serve the existing output without generating it first",
+				},
+				&cli.BoolFlag{
+					Name:  "raw",
+					Usage: "serve the markdown files as is instead of rendering them to html, disables live reload",
+				},
+			},
+			Before: initState(true),
+			Action: serve,
+		},
+	}
 }
 
-func main() {
-	cmd := &cli.Command{
+var profileFile *os.File
+
+// starts the cpu profile requested with --profile, for looking into slow runs on large repos
+func startProfile(ctx context.Context, c *cli.Command) (context.Context, error) {
+	path := c.String("profile")
+	if path == "" {
+		return ctx, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to create profile: %w", err)
+	}
+
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return ctx, fmt.Errorf("failed to start profile: %w", err)
+	}
+	profileFile = f
+
+	return ctx, nil
+}
+
+func stopProfile(ctx context.Context, c *cli.Command) error {
+	if profileFile == nil {
+		return nil
+	}
+
+	pprof.StopCPUProfile()
+	err := profileFile.Close()
+	profileFile = nil
+
+	return err
+}
+
+// the kdoc root command, built on every call so runs don't share flag state
+func newApp() *cli.Command {
+	return &cli.Command{
 		Name:  "kdoc",
 		Usage: "addon to klarity, for generating docs directly from source code",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "output",
 				Aliases: []string{"o"},
-				Usage:   "where should kdoc output the generated docs",
+				Usage:   "where should kdoc output the generated docs, a path ending in .zip writes a zip archive instead",
 				Value:   config.CFG.OutputPath,
 			},
 			&cli.StringFlag{
@@ -302,16 +1251,33 @@ func main() {
 				Aliases: []string{"s"},
 				Usage:   "allows kdoc to also scan it's output directory for files to document",
 			},
+			&cli.BoolFlag{
+				Name:  "warnings-as-errors",
+				Usage: "exit with an error if any warnings were reported",
+			},
+			&cli.BoolFlag{
+				Name:  "config-search-upward",
+				Usage: "use the nearest kdoc.toml in the root or its parent directories instead of creating one in the root, paths are still resolved from the root",
+			},
 			&cli.BoolFlag{
 				Name:    "no-git",
 				Aliases: []string{"g"},
 				Usage:   "disable git metadata collection, and embedding",
 			},
+			&cli.StringFlag{
+				Name:   "profile",
+				Usage:  "write a pprof cpu profile of the whole run to this file",
+				Hidden: true,
+			},
 		},
-		Commands: cmds,
+		Before:   startProfile,
+		After:    stopProfile,
+		Commands: commands(),
 	}
+}
 
-	if err := cmd.Run(context.Background(), os.Args); err != nil {
+func main() {
+	if err := newApp().Run(context.Background(), os.Args); err != nil {
 		log.Fatal(err)
 	}
 }
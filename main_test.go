@@ -0,0 +1,986 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kociumba/kdoc/config"
+	"github.com/kociumba/kdoc/report"
+)
+
+// the default config as toml, decoded again before every run so tests never share maps or slices
+var defaultConfig string
+
+func TestMain(m *testing.M) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(config.CFG); err != nil {
+		panic(err)
+	}
+	defaultConfig = buf.String()
+
+	os.Exit(m.Run())
+}
+
+// runs kdoc with args from a clean state, like a fresh process would
+func runKdoc(t testing.TB, args ...string) error {
+	t.Helper()
+
+	var cfg config.Config
+	if _, err := toml.Decode(defaultConfig, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	config.CFG = cfg
+	out, root, config_path = "", "", ""
+	report.Reset()
+
+	return newApp().Run(context.Background(), append([]string{"kdoc"}, args...))
+}
+
+// runs kdoc like runKdoc and returns what it printed to stdout
+func runKdocOutput(t testing.TB, args ...string) (string, error) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	printed := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		printed <- string(data)
+	}()
+
+	err = runKdoc(t, args...)
+	w.Close()
+	return <-printed, err
+}
+
+// creates files under dir from a path to content map, paths use forward slashes
+func writeTree(t testing.TB, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// turns dir into a git repository with a github remote and commits everything in it
+func gitCommitAll(t *testing.T, dir, message string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		gitRun(t, dir, "init", "-q", "-b", "main")
+		gitRun(t, dir, "remote", "add", "origin", "https://github.com/acme/widgets.git")
+	}
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-q", "-m", message)
+}
+
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com",
+		"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	)
+	data, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, data)
+	}
+	return string(data)
+}
+
+func readFile(t testing.TB, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDirectoryConfigOverridesDocComment(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":     "",
+		"a.c":           "/// root module\n\n/// root doc\nvoid root_fn(void);\n",
+		"sub/kdoc.toml": "doc_comment = \"//!\"\n",
+		"sub/b.c":       "//! sub module\n\n//! sub doc\nvoid sub_fn(void);\n/// not a doc comment here\nvoid other(void);\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	root := readFile(t, filepath.Join(dir, "docs", "a.md"))
+	if !strings.Contains(root, "root doc") {
+		t.Errorf("a.md lost the /// comment:\n%s", root)
+	}
+
+	sub := readFile(t, filepath.Join(dir, "docs", "sub", "b.md"))
+	if !strings.Contains(sub, "sub doc") || !strings.Contains(sub, "sub_fn") {
+		t.Errorf("sub/b.md misses the //! comment:\n%s", sub)
+	}
+	if strings.Contains(sub, "not a doc comment here") {
+		t.Errorf("sub/b.md used the root prefix:\n%s", sub)
+	}
+}
+
+func TestDirectoryConfigWarnsOnProjectKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":     "",
+		"sub/kdoc.toml": "doc_comment = \"//!\"\nshow_file_stats = true\n",
+		"sub/b.c":       "//! sub module\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "--warnings-as-errors", "generate"); err == nil {
+		t.Error("expected the unsupported show_file_stats override to be reported")
+	}
+}
+
+func TestFlatOutputSameNameFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "flat_output = true\n",
+		"a/util.c":  "/// module a, see [b/util.c#beta]\n\n/// alpha doc\nvoid alpha(void);\n",
+		"b/util.c":  "/// module b, see [alpha]\n\n/// beta doc\nvoid beta(void);\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	a := readFile(t, filepath.Join(dir, "docs", "a_util.md"))
+	b := readFile(t, filepath.Join(dir, "docs", "b_util.md"))
+	if !strings.Contains(a, "alpha doc") || !strings.Contains(b, "beta doc") {
+		t.Fatalf("same-named files overwrote each other:\n%s\n%s", a, b)
+	}
+	if !strings.Contains(a, "(b_util.md#beta)") {
+		t.Errorf("a_util.md doesn't link to beta:\n%s", a)
+	}
+	if !strings.Contains(b, "(a_util.md#alpha)") {
+		t.Errorf("b_util.md doesn't link to alpha:\n%s", b)
+	}
+}
+
+func TestFlatOutputWarnsOnCollisions(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "flat_output = true\n",
+		"a/b_c.c":   "/// module\n",
+		"a_b/c.c":   "/// module\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "--warnings-as-errors", "generate"); err == nil {
+		t.Error("expected a/b_c.c and a_b/c.c both written to a_b_c.md to be reported")
+	}
+}
+
+func TestNoIndexAndIndexOnly(t *testing.T) {
+	files := map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module\n\n/// doc\nvoid foo(void);\n",
+	}
+
+	dir := t.TempDir()
+	writeTree(t, dir, files)
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate", "--no-index"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", "a.md")); err != nil {
+		t.Errorf("--no-index didn't write the file page: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", "index.md")); err == nil {
+		t.Error("--no-index wrote index.md")
+	}
+
+	dir = t.TempDir()
+	writeTree(t, dir, files)
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate", "--index-only"); err != nil {
+		t.Fatal(err)
+	}
+	if index := readFile(t, filepath.Join(dir, "docs", "index.md")); !strings.Contains(index, "a.md") {
+		t.Errorf("--index-only index misses a.md:\n%s", index)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", "a.md")); err == nil {
+		t.Error("--index-only wrote the file page")
+	}
+}
+
+func TestIndexOnlyRejectsZip(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module\n",
+	})
+	archive := filepath.Join(dir, "docs.zip")
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "--output", archive, "generate"); err != nil {
+		t.Fatal(err)
+	}
+	before := readFile(t, archive)
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "--output", archive, "generate", "--index-only"); err == nil {
+		t.Error("--index-only with a zip output should fail")
+	}
+	if readFile(t, archive) != before {
+		t.Error("the rejected run modified the archive")
+	}
+}
+
+func TestGenerateFromTaggedRef(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module\n\n/// released doc\nvoid released(void);\n",
+	})
+	gitCommitAll(t, dir, "release")
+	gitRun(t, dir, "tag", "v1.0.0")
+
+	writeTree(t, dir, map[string]string{
+		"a.c": "/// module\n\n/// work in progress\nvoid unreleased(void);\n",
+		"b.c": "/// new file\n",
+	})
+	gitCommitAll(t, dir, "more work")
+
+	if err := runKdoc(t, "--root", dir, "generate", "--ref", "v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	page := readFile(t, filepath.Join(dir, "docs", "a.md"))
+	if !strings.Contains(page, "released doc") || strings.Contains(page, "unreleased") {
+		t.Errorf("a.md isn't generated from v1.0.0:\n%s", page)
+	}
+	if !strings.Contains(page, "<code>v1.0.0</code>") || strings.Contains(page, "<code>main</code>") {
+		t.Errorf("the card doesn't show the ref as the branch:\n%s", page)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", "b.md")); err == nil {
+		t.Error("b.md was documented although it doesn't exist at v1.0.0")
+	}
+}
+
+// a project of n documented files spread over a few directories
+func manyFiles(n int) map[string]string {
+	files := map[string]string{"kdoc.toml": "write_concurrency = 8\n"}
+	for i := range n {
+		files[fmt.Sprintf("d%d/f%d.c", i%5, i)] = fmt.Sprintf("/// module %d\n\n/// doc of fn%d\nvoid fn%d(void);\n", i, i, i)
+	}
+	return files
+}
+
+func TestConcurrentWrite(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, manyFiles(60))
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "--warnings-as-errors", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 60 {
+		page := readFile(t, filepath.Join(dir, "docs", fmt.Sprintf("d%d", i%5), fmt.Sprintf("f%d.md", i)))
+		if !strings.Contains(page, fmt.Sprintf("doc of fn%d\n", i)) {
+			t.Errorf("f%d.md has the wrong content:\n%s", i, page)
+		}
+	}
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	dir := b.TempDir()
+	writeTree(b, dir, manyFiles(200))
+
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("write_concurrency=%d", workers), func(b *testing.B) {
+			writeTree(b, dir, map[string]string{"kdoc.toml": fmt.Sprintf("write_concurrency = %d\n", workers)})
+			for b.Loop() {
+				if err := runKdoc(b, "--root", dir, "--no-git", "generate"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestZipOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module a\n",
+		"sub/b.c":   "/// module b\n",
+	})
+	archive := filepath.Join(dir, "out", "docs.zip")
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "--output", archive, "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var entries []string
+	for _, f := range r.File {
+		entries = append(entries, f.Name)
+	}
+	slices.Sort(entries)
+	if want := []string{"a.md", "index.md", "sub/b.md"}; !slices.Equal(entries, want) {
+		t.Errorf("zip entries = %v, want %v", entries, want)
+	}
+}
+
+func TestPassthroughMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	notes := "# Design notes\n\nWritten by hand.\n"
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":       "scan_exclusions = []\npassthrough_extensions = [\".md\"]\n",
+		"a.c":             "/// module\n",
+		"guide/design.md": notes,
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(dir, "docs", "guide", "design.md")); got != notes {
+		t.Errorf("design.md = %q, want it copied verbatim", got)
+	}
+	if index := readFile(t, filepath.Join(dir, "docs", "index.md")); !strings.Contains(index, "(guide/design.md)") {
+		t.Errorf("index doesn't list design.md:\n%s", index)
+	}
+}
+
+func TestRelatedFilesByDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":  "related_files = \"directory\"\n",
+		"gfx/a.c":    "/// module a\n",
+		"gfx/b.c":    "/// module b\n",
+		"net/sock.c": "/// module sock\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	a := readFile(t, filepath.Join(dir, "docs", "gfx", "a.md"))
+	if !strings.Contains(a, "## Related Files") || !strings.Contains(a, "(b.md)") {
+		t.Errorf("a.md doesn't relate b.c:\n%s", a)
+	}
+	if strings.Contains(a, "sock") {
+		t.Errorf("a.md relates a file of another directory:\n%s", a)
+	}
+	if sock := readFile(t, filepath.Join(dir, "docs", "net", "sock.md")); strings.Contains(sock, "Related Files") {
+		t.Errorf("sock.md has related files although it's alone in net:\n%s", sock)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module a\n",
+		"sub/b.c":   "/// module b\n",
+	})
+
+	printed, err := runKdocOutput(t, "--root", dir, "--no-git", "generate", "--dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "docs")); err == nil {
+		t.Error("--dry-run created the output directory")
+	}
+	if !strings.Contains(printed, "Dry run, 3 files would be written:") {
+		t.Errorf("missing the planned file count:\n%s", printed)
+	}
+	for _, page := range []string{"a.md", "index.md", "sub/b.md"} {
+		if !strings.Contains(printed, filepath.ToSlash(filepath.Join(dir, "docs", page))+" (") {
+			t.Errorf("%s isn't listed:\n%s", page, printed)
+		}
+	}
+}
+
+func TestScanRootSubdirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":      "scan_root = \"src\"\n",
+		"src/core/a.c":   "/// module a\n",
+		"src/b.c":        "/// module b\n",
+		"tools/ignore.c": "/// not scanned\n",
+	})
+
+	// running from elsewhere must give the same layout
+	t.Chdir(t.TempDir())
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, page := range []string{"core/a.md", "b.md", "index.md"} {
+		if _, err := os.Stat(filepath.Join(dir, "docs", filepath.FromSlash(page))); err != nil {
+			t.Errorf("%s wasn't written under the output path: %v", page, err)
+		}
+	}
+	for _, page := range []string{"src/core/a.md", "tools/ignore.md"} {
+		if _, err := os.Stat(filepath.Join(dir, "docs", filepath.FromSlash(page))); err == nil {
+			t.Errorf("%s was written, pages must mirror the tree below scan_root", page)
+		}
+	}
+}
+
+func TestWarningsAsErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module, see [missing_symbol]\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatalf("warnings failed a normal run: %v", err)
+	}
+
+	err := runKdoc(t, "--root", dir, "--no-git", "--warnings-as-errors", "generate")
+	if err == nil || !strings.Contains(err.Error(), "1 warnings reported") {
+		t.Errorf("err = %v, want the unresolved backlink to fail the run", err)
+	}
+}
+
+func TestTrailingNewline(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module\n\n/// doc\nvoid foo(void);\n\n\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range []string{"a.md", "index.md"} {
+		data := readFile(t, filepath.Join(dir, "docs", page))
+		if !strings.HasSuffix(data, "\n") || strings.HasSuffix(data, "\n\n") {
+			t.Errorf("%s doesn't end with exactly one newline: %q", page, data[max(len(data)-20, 0):])
+		}
+	}
+
+	writeTree(t, dir, map[string]string{"kdoc.toml": "trailing_newline = false\n"})
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+	if data := readFile(t, filepath.Join(dir, "docs", "a.md")); strings.HasSuffix(data, "\n") {
+		t.Errorf("a.md ends with a newline with trailing_newline = false: %q", data[max(len(data)-20, 0):])
+	}
+}
+
+func TestLanguageIndexes(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "language_indexes = true\n",
+		"a.cpp":     "/// module a\n",
+		"b.h":       "/// module b\n",
+		"c.c":       "/// module c\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	cpp := readFile(t, filepath.Join(dir, "docs", "cpp-index.md"))
+	if !strings.Contains(cpp, "(a.md)") || !strings.Contains(cpp, "(b.md)") || strings.Contains(cpp, "(c.md)") {
+		t.Errorf("cpp-index.md should list only a.cpp and b.h:\n%s", cpp)
+	}
+	if c := readFile(t, filepath.Join(dir, "docs", "c-index.md")); !strings.Contains(c, "(c.md)") || strings.Contains(c, "(a.md)") {
+		t.Errorf("c-index.md should list only c.c:\n%s", c)
+	}
+}
+
+func TestConfigSearchUpward(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":        "doc_comment = \"//!\"\n",
+		"libs/widgets/a.c": "//! module\n\n//! shared prefix doc\nvoid foo(void);\n",
+	})
+	nested := filepath.Join(dir, "libs", "widgets")
+
+	if err := runKdoc(t, "--root", nested, "--no-git", "--config-search-upward", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	if page := readFile(t, filepath.Join(nested, "docs", "a.md")); !strings.Contains(page, "shared prefix doc") {
+		t.Errorf("the parent config wasn't used:\n%s", page)
+	}
+	if _, err := os.Stat(filepath.Join(nested, "kdoc.toml")); err == nil {
+		t.Error("a default config was created in the nested root")
+	}
+}
+
+func TestIncludeExtensionlessFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":         "[include_files]\n\"scripts/bootstrap\" = \"sh\"\n\n[doc_comment_by_lang]\nsh = \"##\"\n",
+		"a.c":               "/// module\n",
+		"scripts/bootstrap": "## sets up the tree\n\n## installs the deps\ninstall() {\n",
+		"scripts/other":     "## not included\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	page := readFile(t, filepath.Join(dir, "docs", "scripts", "bootstrap.md"))
+	if !strings.Contains(page, "installs the deps") || !strings.Contains(page, "```sh\ninstall()") {
+		t.Errorf("bootstrap isn't documented as sh:\n%s", page)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", "scripts", "other.md")); err == nil {
+		t.Error("a file that isn't included was documented")
+	}
+}
+
+func TestReadmeIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "index_files = [\"index.md\", \"README.md\"]\n",
+		"a.c":       "/// module a\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	readme := readFile(t, filepath.Join(dir, "docs", "README.md"))
+	if !strings.Contains(readme, "(a.md)") {
+		t.Errorf("README.md doesn't list a.c:\n%s", readme)
+	}
+	if index := readFile(t, filepath.Join(dir, "docs", "index.md")); index != readme {
+		t.Error("index.md and README.md differ")
+	}
+}
+
+func TestMergeMarkersKeepHandWrittenContent(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "merge_markers = true\n",
+		"a.c":       "/// module a\n\n/// first doc\nvoid foo(void);\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate", "--no-index"); err != nil {
+		t.Fatal(err)
+	}
+	page := filepath.Join(dir, "docs", "a.md")
+	edited := "hand written intro\n\n" + readFile(t, page) + "\nhand written footer\n"
+	writeTree(t, dir, map[string]string{
+		"docs/a.md": edited,
+		"a.c":       "/// module a\n\n/// second doc\nvoid foo(void);\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate", "--no-index"); err != nil {
+		t.Fatal(err)
+	}
+
+	md := readFile(t, page)
+	if !strings.HasPrefix(md, "hand written intro\n\n<!-- kdoc:begin -->\n") || !strings.HasSuffix(md, "<!-- kdoc:end -->\n\nhand written footer\n") {
+		t.Errorf("hand written content wasn't kept:\n%s", md)
+	}
+	if !strings.Contains(md, "second doc") || strings.Contains(md, "first doc") {
+		t.Errorf("the generated region wasn't replaced:\n%s", md)
+	}
+}
+
+func TestSkipHidden(t *testing.T) {
+	for _, skip := range []bool{true, false} {
+		t.Run(strconv.FormatBool(skip), func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{
+				"kdoc.toml":       "skip_hidden = " + strconv.FormatBool(skip) + "\n",
+				"a.cpp":           "/// module a\n",
+				".hidden/foo.cpp": "/// module foo\n",
+				".git/bar.cpp":    "/// module bar\n",
+			})
+
+			if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := os.Stat(filepath.Join(dir, "docs", ".hidden", "foo.md"))
+			if skip && err == nil {
+				t.Error(".hidden/foo.cpp was documented with skip_hidden = true")
+			} else if !skip && err != nil {
+				t.Errorf(".hidden/foo.cpp wasn't documented with skip_hidden = false: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "docs", ".git", "bar.md")); err == nil {
+				t.Error(".git was scanned")
+			}
+		})
+	}
+}
+
+func TestOutputIsScanRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module a\n",
+	})
+
+	err := runKdoc(t, "--root", dir, "--no-git", "--output", dir, "generate")
+	if err == nil || !strings.Contains(err.Error(), "is the scan root") {
+		t.Fatalf("err = %v, want the output path rejected", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.md")); err == nil {
+		t.Error("docs were written into the scan root")
+	}
+}
+
+func TestConfigShowReflectsFlags(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"kdoc.toml": "output_path = \"./docs\"\n"})
+
+	printed, err := runKdocOutput(t, "--root", dir, "--output", "./site", "config", "show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(printed, "output_path = \"site\"") {
+		t.Errorf("the --output override isn't in the printed config:\n%s", printed)
+	}
+}
+
+func TestSingleFileCrossLinks(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module a\n\n/// opens a widget\nvoid open_widget(void);\n",
+		"sub/b.c":   "/// module b\n\n/// closes what [open_widget] opened\nvoid close_widget(void);\n",
+	})
+	target := filepath.Join(dir, "book.md")
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate", "--single-file", target); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := readFile(t, target)
+	if !strings.Contains(doc, "[open_widget](#a-open_widget)") {
+		t.Errorf("the backlink from sub/b.c doesn't point into the document:\n%s", doc)
+	}
+	if !strings.Contains(doc, `<a id="a-open_widget"></a>`) && !strings.Contains(doc, "{#a-open_widget}") {
+		t.Errorf("the document has no a-open_widget anchor:\n%s", doc)
+	}
+	if strings.Contains(doc, ".md#") || strings.Contains(doc, ".md)") {
+		t.Errorf("the document still links to separate pages:\n%s", doc)
+	}
+}
+
+func TestTimings(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module a\n",
+	})
+
+	printed, err := runKdocOutput(t, "--root", dir, "--no-git", "generate", "--timings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, breakdown, ok := strings.Cut(printed, "Timings:\n")
+	if !ok {
+		t.Fatalf("no timings printed:\n%s", printed)
+	}
+	for _, label := range []string{"collection", "parsing", "git metadata", "index building", "writing"} {
+		if !strings.Contains(breakdown, "  "+label+" ") {
+			t.Errorf("timings miss the %s phase:\n%s", label, breakdown)
+		}
+	}
+
+	if printed, _ := runKdocOutput(t, "--root", dir, "--no-git", "generate"); strings.Contains(printed, "Timings:") {
+		t.Errorf("timings printed without --timings:\n%s", printed)
+	}
+}
+
+func TestOnlyTracked(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":  "only_tracked = true\n",
+		"tracked.c":  "/// module tracked\n",
+		".gitignore": "docs/\n",
+	})
+	gitCommitAll(t, dir, "add tracked")
+	writeTree(t, dir, map[string]string{"untracked.c": "/// module untracked\n"})
+
+	if err := runKdoc(t, "--root", dir, "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "docs", "tracked.md")); err != nil {
+		t.Errorf("the tracked file wasn't documented: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", "untracked.md")); err == nil {
+		t.Error("the untracked file was documented with only_tracked")
+	}
+}
+
+func TestNameTag(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module a\n\n/// registers the widget type\n/// @name RegisterWidget\nDECLARE_TYPE(widget, 4);\n",
+		"b.c":       "/// module b\n\n/// call after [RegisterWidget]\nvoid use_widget(void);\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	a := readFile(t, filepath.Join(dir, "docs", "a.md"))
+	if !strings.Contains(a, "#### RegisterWidget\n") || !strings.Contains(a, "](#registerwidget)") {
+		t.Errorf("@name didn't replace the heading and anchor:\n%s", a)
+	}
+	if strings.Contains(a, "DECLARE_TYPE\n") || strings.Contains(a, "#declare_type") {
+		t.Errorf("the extracted ID is still used:\n%s", a)
+	}
+	if b := readFile(t, filepath.Join(dir, "docs", "b.md")); !strings.Contains(b, "[RegisterWidget](a.md#registerwidget)") {
+		t.Errorf("the backlink doesn't resolve the @name ID:\n%s", b)
+	}
+}
+
+func TestRecentCommits(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":  "recent_commits = 2\n",
+		".gitignore": "docs/\n",
+		"a.c":        "/// module a\n",
+	})
+	gitCommitAll(t, dir, "add a")
+	for _, msg := range []string{"describe a", "expand a"} {
+		writeTree(t, dir, map[string]string{"a.c": "/// module a, " + msg + "\n"})
+		gitCommitAll(t, dir, msg)
+	}
+	hashes := strings.Fields(gitRun(t, dir, "log", "--format=%H", "-2"))
+
+	if err := runKdoc(t, "--root", dir, "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	page := readFile(t, filepath.Join(dir, "docs", "a.md"))
+	_, log, ok := strings.Cut(page, "<summary>Recent changes</summary>\n\n")
+	if !ok {
+		t.Fatalf("no recent changes section:\n%s", page)
+	}
+	for i, msg := range []string{"expand a", "describe a"} {
+		link := fmt.Sprintf("- [`%s`](https://github.com/acme/widgets/commit/%s) ", hashes[i][:7], hashes[i])
+		if !strings.Contains(log, link) || !strings.Contains(log, msg+"\n") {
+			t.Errorf("the mini-log misses %s %q:\n%s", link, msg, log)
+		}
+	}
+	if strings.Contains(log, "add a\n") {
+		t.Errorf("the mini-log lists more than 2 commits:\n%s", log)
+	}
+}
+
+func TestIndexReadme(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "index_readme = \"README.md\"\n",
+		"README.md": "# Widgets\n\nA toolkit for drawing widgets.\n",
+		"a.c":       "/// module a\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	index := readFile(t, filepath.Join(dir, "docs", "index.md"))
+	intro := strings.Index(index, "# Widgets\n\nA toolkit for drawing widgets.\n")
+	listing := strings.Index(index, "(a.md)")
+	if intro != 0 || listing < intro {
+		t.Errorf("the README should open the index, followed by the listing:\n%s", index)
+	}
+}
+
+func TestUncommittedCard(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(strconv.FormatBool(enabled), func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{
+				"kdoc.toml":  "uncommitted_card = " + strconv.FormatBool(enabled) + "\n",
+				".gitignore": "docs/\n",
+				"a.c":        "/// module a\n",
+			})
+			gitCommitAll(t, dir, "add a")
+			writeTree(t, dir, map[string]string{"new.c": "/// module new\n"})
+
+			if err := runKdoc(t, "--root", dir, "generate"); err != nil {
+				t.Fatal(err)
+			}
+
+			page := readFile(t, filepath.Join(dir, "docs", "new.md"))
+			if has := strings.Contains(page, "<em>Not yet committed</em>"); has != enabled {
+				t.Errorf("placeholder card rendered = %v, want %v:\n%s", has, enabled, page)
+			}
+			if a := readFile(t, filepath.Join(dir, "docs", "a.md")); strings.Contains(a, "Not yet committed") {
+				t.Errorf("the committed file got the placeholder:\n%s", a)
+			}
+		})
+	}
+}
+
+func TestLowercaseOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":       "output_case = \"lower\"\n",
+		"Gfx/DrawUtils.c": "/// module draw\n\n/// draws\nvoid Draw(void);\n",
+		"Main.c":          "/// module main\n\n/// calls [Draw]\nvoid run(void);\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"gfx/drawutils.md", "main.md"} {
+		if _, err := os.Stat(filepath.Join(dir, "docs", filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s wasn't written: %v", name, err)
+		}
+	}
+	if main := readFile(t, filepath.Join(dir, "docs", "main.md")); !strings.Contains(main, "[Draw](gfx/drawutils.md#draw)") {
+		t.Errorf("the backlink doesn't use the lowercase name:\n%s", main)
+	}
+	if index := readFile(t, filepath.Join(dir, "docs", "index.md")); !strings.Contains(index, "(gfx/drawutils.md)") || !strings.Contains(index, "(main.md)") {
+		t.Errorf("the index doesn't link the lowercase names:\n%s", index)
+	}
+}
+
+func TestDuplicateIDs(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module a\n\n/// first foo\nvoid foo(void);\n",
+		"b.c":       "/// module b\n\n/// second foo\nvoid foo(int x);\n",
+		"c.c":       "/// module c\n\n/// calls [foo] and [b.c#foo]\nvoid run(void);\n",
+	})
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(logged.String(), "foo is defined in a.c:3 and b.c:3") {
+		t.Errorf("the collision wasn't reported with both locations:\n%s", logged.String())
+	}
+	if report.Count() != 1 {
+		t.Errorf("%d warnings, want the collision reported once", report.Count())
+	}
+	c := readFile(t, filepath.Join(dir, "docs", "c.md"))
+	if !strings.Contains(c, "[foo](a.md#foo)") || !strings.Contains(c, "[foo](b.md#foo)") {
+		t.Errorf("[foo] should link a.c and [b.c#foo] b.c:\n%s", c)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module a\n",
+	})
+	profile := filepath.Join(t.TempDir(), "cpu.pprof")
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "--profile", profile, "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(profile)
+	if err != nil {
+		t.Fatalf("no profile was written: %v", err)
+	}
+	if info.Size() == 0 {
+		t.Error("the profile is empty")
+	}
+}
+
+func TestIndexOnlyKeepsFeed(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml":  "feed_base_url = \"https://docs.example.com/\"\n",
+		".gitignore": "docs/\n",
+		"a.c":        "/// module a\n",
+	})
+	gitCommitAll(t, dir, "add a")
+
+	if err := runKdoc(t, "--root", dir, "generate"); err != nil {
+		t.Fatal(err)
+	}
+	feed := readFile(t, filepath.Join(dir, "docs", "feed.json"))
+	if !strings.Contains(feed, `"content_text": "add a"`) {
+		t.Fatalf("feed.json doesn't list a.c:\n%s", feed)
+	}
+
+	if err := runKdoc(t, "--root", dir, "generate", "--index-only"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "docs", "feed.json")); got != feed {
+		t.Errorf("--index-only changed feed.json:\n%s\nwant:\n%s", got, feed)
+	}
+}
+
+func TestMergeMarkersWithFrontMatter(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "merge_markers = true\nfront_matter = [\"title\"]\n",
+		"a.c":       "/// module a\n\n/// first doc\nvoid foo(void);\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate", "--no-index"); err != nil {
+		t.Fatal(err)
+	}
+	page := filepath.Join(dir, "docs", "a.md")
+	const front = "---\ntitle: \"a.c\"\n---\n\n"
+	md := readFile(t, page)
+	if !strings.HasPrefix(md, front+"<!-- kdoc:begin -->\n# a.c\n") {
+		t.Fatalf("the front matter isn't on the first line above the begin marker:\n%s", md)
+	}
+
+	_, managed, _ := strings.Cut(md, front)
+	writeTree(t, dir, map[string]string{
+		"docs/a.md": front + "hand written intro\n\n" + managed,
+		"a.c":       "/// module a\n\n/// second doc\nvoid foo(void);\n",
+	})
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate", "--no-index"); err != nil {
+		t.Fatal(err)
+	}
+
+	md = readFile(t, page)
+	if !strings.HasPrefix(md, front+"hand written intro\n\n<!-- kdoc:begin -->\n# a.c\n") {
+		t.Errorf("the front matter or the hand written intro moved:\n%s", md)
+	}
+	if n := strings.Count(md, "title: "); n != 1 {
+		t.Errorf("%d front matter blocks, want 1:\n%s", n, md)
+	}
+	if !strings.Contains(md, "second doc") {
+		t.Errorf("the generated region wasn't replaced:\n%s", md)
+	}
+}
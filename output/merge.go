@@ -0,0 +1,48 @@
+package output
+
+import "strings"
+
+const (
+	MergeBegin = "<!-- kdoc:begin -->"
+	MergeEnd   = "<!-- kdoc:end -->"
+)
+
+// Merge splices generated between the kdoc markers of existing, keeping the hand written
+// content around them, if existing has no complete marker pair the generated content is
+// returned wrapped in fresh markers so the next run can merge into it, yaml front matter of
+// generated goes above the begin marker since renderers only read it at the start of the file
+func Merge(existing, generated string) string {
+	front, generated := splitFrontMatter(generated)
+	if front != "" {
+		_, existing = splitFrontMatter(existing)
+	}
+
+	block := MergeBegin + "\n" + strings.TrimRight(generated, "\n") + "\n" + MergeEnd
+
+	begin := strings.Index(existing, MergeBegin)
+	end := strings.LastIndex(existing, MergeEnd)
+	if begin == -1 || end == -1 || end < begin {
+		if strings.HasSuffix(generated, "\n") {
+			block += "\n"
+		}
+		return front + block
+	}
+
+	return front + existing[:begin] + block + existing[end+len(MergeEnd):]
+}
+
+// splits a leading yaml front matter block and the blank lines after it from the rest of doc
+func splitFrontMatter(doc string) (front, rest string) {
+	body, ok := strings.CutPrefix(doc, "---\n")
+	if !ok {
+		return "", doc
+	}
+
+	end := strings.Index(body, "\n---\n")
+	if end == -1 {
+		return "", doc
+	}
+
+	rest = strings.TrimLeft(body[end+len("\n---\n"):], "\n")
+	return doc[:len(doc)-len(rest)], rest
+}
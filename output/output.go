@@ -0,0 +1,194 @@
+package output
+
+import (
+	"archive/zip"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Writer is the destination for generated docs, paths passed to WriteFile
+// are always slash separated and relative to the output root
+type Writer interface {
+	WriteFile(path string, data []byte) error
+	Close() error
+}
+
+// picks a writer based on the output target, a target ending in .zip produces an archive,
+// anything else is treated as a directory on disk
+func New(target string) (Writer, error) {
+	if IsZip(target) {
+		return NewZipWriter(target)
+	}
+
+	return NewFSWriter(target), nil
+}
+
+func IsZip(target string) bool {
+	return strings.EqualFold(filepath.Ext(target), ".zip")
+}
+
+type FSWriter struct {
+	Root string
+}
+
+func NewFSWriter(root string) *FSWriter {
+	return &FSWriter{Root: root}
+}
+
+func (w *FSWriter) WriteFile(path string, data []byte) error {
+	full := longPath(filepath.Join(w.Root, filepath.FromSlash(path)))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(full, data)
+}
+
+// WriteFileAtomic writes data to a temp file next to path and renames it into place,
+// so an interrupted run never leaves a partially written file behind, new files get 0644
+// minus the umask like os.WriteFile and replaced files keep their mode
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := createTemp(path, 0644)
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(tmpName, info.Mode().Perm()); err != nil {
+			os.Remove(tmpName)
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return nil
+}
+
+// creates a new temp file next to path, unlike os.CreateTemp it takes the mode so the umask
+// is applied by the system
+func createTemp(path string, perm os.FileMode) (*os.File, error) {
+	for {
+		name := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+strconv.FormatUint(rand.Uint64(), 36)+".tmp")
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) {
+			return f, err
+		}
+	}
+}
+
+func (w *FSWriter) Close() error {
+	return nil
+}
+
+// on windows paths longer than MAX_PATH (260) fail unless they use the extended length \\?\ form,
+// which deeply nested doc trees easily exceed
+func longPath(path string) string {
+	if runtime.GOOS != "windows" || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+
+	return `\\?\` + abs
+}
+
+// ZipWriter builds the archive in a temp file that only replaces the target on Close
+type ZipWriter struct {
+	target string
+	f      *os.File
+	zw     *zip.Writer
+	mu     sync.Mutex
+}
+
+func NewZipWriter(target string) (*ZipWriter, error) {
+	target = longPath(target)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ZipWriter{target: target, f: f, zw: zip.NewWriter(f)}, nil
+}
+
+func (w *ZipWriter) WriteFile(path string, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entry, err := w.zw.Create(filepath.ToSlash(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = entry.Write(data)
+	return err
+}
+
+func (w *ZipWriter) Close() error {
+	err := w.zw.Close()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(w.f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(w.f.Name(), w.target)
+	}
+
+	if err != nil {
+		os.Remove(w.f.Name())
+	}
+	return err
+}
+
+// MemoryWriter keeps all written files in memory, mainly useful for library use
+type MemoryWriter struct {
+	Files map[string][]byte
+	mu    sync.Mutex
+}
+
+func NewMemoryWriter() *MemoryWriter {
+	return &MemoryWriter{Files: make(map[string][]byte)}
+}
+
+func (w *MemoryWriter) WriteFile(path string, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.Files[filepath.ToSlash(path)] = append([]byte(nil), data...)
+	return nil
+}
+
+func (w *MemoryWriter) Close() error {
+	return nil
+}
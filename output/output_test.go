@@ -0,0 +1,199 @@
+package output
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writes n files from n goroutines, file i contains its own name so mixed up writes show
+func writeConcurrently(t testing.TB, w Writer, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("dir%d/page%d.md", i%4, i)
+			if err := w.WriteFile(name, []byte(name)); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSWriterConcurrent(t *testing.T) {
+	root := t.TempDir()
+	writeConcurrently(t, NewFSWriter(root), 100)
+
+	for i := range 100 {
+		name := fmt.Sprintf("dir%d/page%d.md", i%4, i)
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil || string(data) != name {
+			t.Errorf("%s = %q, %v", name, data, err)
+		}
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(root, "*", ".*.tmp"))
+	if len(leftovers) > 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+}
+
+func TestZipWriterConcurrent(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "docs.zip")
+	w, err := NewZipWriter(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeConcurrently(t, w, 100)
+
+	r, err := zip.OpenReader(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if len(r.File) != 100 {
+		t.Errorf("archive has %d entries, want 100", len(r.File))
+	}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != f.Name {
+			t.Errorf("%s = %q", f.Name, data)
+		}
+	}
+}
+
+func BenchmarkFSWriter(b *testing.B) {
+	for b.Loop() {
+		writeConcurrently(b, NewFSWriter(b.TempDir()), 100)
+	}
+}
+
+func TestFSWriterDeepPath(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("MAX_PATH only limits paths on windows")
+	}
+
+	root := t.TempDir()
+	deep := strings.Repeat("nested_directory/", 20) + "page.md"
+	if full := filepath.Join(root, deep); len(full) <= 260 {
+		t.Fatalf("path of %d characters doesn't exceed MAX_PATH", len(full))
+	}
+
+	if err := NewFSWriter(root).WriteFile(deep, []byte("deep")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(longPath(filepath.Join(root, filepath.FromSlash(deep))))
+	if err != nil || string(data) != "deep" {
+		t.Errorf("read back %q, %v", data, err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "page.md")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("read back %q, want %q", data, "new")
+	}
+	// a rename replaces the file, writing in place would keep it
+	if os.SameFile(before, after) {
+		t.Error("page.md was written in place instead of renamed over")
+	}
+
+	// a directory in the way makes the rename fail after the data was written
+	blocked := filepath.Join(dir, "blocked.md")
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(blocked, []byte("partial")); err == nil {
+		t.Error("writing over a directory succeeded")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("temporary file %s was left behind", e.Name())
+		}
+	}
+}
+
+func TestWriteFileAtomicMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows has no unix permissions")
+	}
+
+	dir := t.TempDir()
+	// os.WriteFile applies the umask, new files must end up with the same mode
+	reference := filepath.Join(dir, "reference.md")
+	if err := os.WriteFile(reference, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fresh := filepath.Join(dir, "fresh.md")
+	if err := WriteFileAtomic(fresh, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fileMode(t, fresh), fileMode(t, reference); got != want {
+		t.Errorf("new file mode = %v, want %v like os.WriteFile", got, want)
+	}
+
+	private := filepath.Join(dir, "private.md")
+	if err := os.WriteFile(private, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(private, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got := fileMode(t, private); got != 0600 {
+		t.Errorf("replaced file mode = %v, want it kept at 0600", got)
+	}
+}
+
+func fileMode(t *testing.T, path string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type Issue struct {
+	File    string
+	Line    int
+	Element string
+	Kind    string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d: [%s] %s: %s", i.File, i.Line, i.Kind, i.Element, i.Message)
+}
+
+// CheckSignatures flags elements whose doc comment is not followed by a plausible declaration,
+// e.g. a comment at the end of a file or one followed by a closing brace
+func CheckSignatures(f *File) []Issue {
+	var issues []Issue
+	for _, e := range f.Elements {
+		msg := ""
+		switch {
+		case strings.TrimSpace(e.Signature) == "":
+			msg = "doc comment is not followed by a declaration"
+		case !strings.ContainsFunc(e.Signature, func(r rune) bool { return unicode.IsLetter(r) || r == '_' }):
+			msg = fmt.Sprintf("implausible signature %q", e.Signature)
+		}
+
+		if msg != "" {
+			issues = append(issues, Issue{
+				File:    f.Path,
+				Line:    e.Line,
+				Element: e.ID,
+				Kind:    "missing-signature",
+				Message: msg,
+			})
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,21 @@
+package parser
+
+import "testing"
+
+func TestCheckSignaturesAtEOF(t *testing.T) {
+	f := parseSource(t, "x.c", "c", `/// module
+
+/// documented
+void foo(void);
+
+/// dangling comment at the end of the file
+`)
+
+	issues := CheckSignatures(f)
+	if len(issues) != 1 {
+		t.Fatalf("issues = %v, want only the comment at the end", issues)
+	}
+	if i := issues[0]; i.Kind != "missing-signature" || i.Line != 6 || i.File != "x.c" {
+		t.Errorf("issue = %+v, want a missing-signature at x.c:6", i)
+	}
+}
@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+)
+
+// line prefixes considered by DetectDocPrefix, longer prefixes first so "///" isn't counted as "//"
+var autoDocPrefixes = []string{"///", "//!", "#", "--"}
+
+// DetectDocPrefix returns the most common doc comment style of a file, block comments compete
+// as well but are parsed regardless of the prefix so a file dominated by them keeps the fallback,
+// ties and files without any doc comments use the fallback too
+func DetectDocPrefix(data []byte, fallback []string) []string {
+	counts := make(map[string]int, len(autoDocPrefixes)+1)
+	blockStart := "/**"
+	for line := range bytes.Lines(data) {
+		trimmed := strings.TrimSpace(string(line))
+		if strings.HasPrefix(trimmed, blockStart) {
+			counts[blockStart]++
+			continue
+		}
+
+		for _, prefix := range autoDocPrefixes {
+			if rest, ok := strings.CutPrefix(trimmed, prefix); ok {
+				// "#include" and "#!" are no comments, neither is "---" in most languages
+				if prefix == "#" || prefix == "--" {
+					if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+						break
+					}
+				}
+				counts[prefix]++
+				break
+			}
+		}
+	}
+
+	best, bestCount, tie := "", 0, false
+	for _, prefix := range append(autoDocPrefixes, blockStart) {
+		switch n := counts[prefix]; {
+		case n > bestCount:
+			best, bestCount, tie = prefix, n, false
+		case n == bestCount && n > 0:
+			tie = true
+		}
+	}
+
+	if best == "" || best == blockStart || tie {
+		return fallback
+	}
+
+	return []string{best}
+}
@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDetectDocPrefix(t *testing.T) {
+	fallback := []string{"///"}
+	for name, tc := range map[string]struct {
+		src  string
+		want []string
+	}{
+		"hash": {
+			src:  "#!/bin/sh\n# module\n\n# installs the deps\ninstall() {\n  /// stray\n}\n# cleans up\nclean() {\n",
+			want: []string{"#"},
+		},
+		"includes aren't comments": {
+			src:  "#include <stdio.h>\n#include <stdlib.h>\n#define N 4\n/// draws\nvoid draw(void);\n",
+			want: []string{"///"},
+		},
+		"tie": {
+			src:  "//! module\n-- query\n",
+			want: fallback,
+		},
+		"none": {
+			src:  "int x;\n",
+			want: fallback,
+		},
+	} {
+		if got := DetectDocPrefix([]byte(tc.src), fallback); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: DetectDocPrefix = %q, want %q", name, got, tc.want)
+		}
+	}
+}
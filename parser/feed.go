@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kociumba/kdoc/git"
+)
+
+// Feed is a JSON Feed (https://jsonfeed.org/version/1.1) of the pages ordered by the last commit
+type Feed struct {
+	Version     string     `json:"version"`
+	Title       string     `json:"title"`
+	HomePageURL string     `json:"home_page_url"`
+	FeedURL     string     `json:"feed_url"`
+	Items       []FeedItem `json:"items"`
+}
+
+type FeedItem struct {
+	ID           string       `json:"id"`
+	URL          string       `json:"url"`
+	Title        string       `json:"title"`
+	ContentText  string       `json:"content_text"`
+	DateModified string       `json:"date_modified,omitempty"`
+	Authors      []FeedAuthor `json:"authors,omitempty"`
+	// the last commit on the provider, empty without a known provider
+	ExternalURL string `json:"external_url,omitempty"`
+}
+
+type FeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// GenerateFeed lists every page with git metadata newest first, links are built from baseURL,
+// the public URL the output directory is hosted at
+func (p *Parser) GenerateFeed(title, baseURL string, docPath func(f *File) string) ([]byte, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/") + "/"
+
+	files := make([]*File, 0, len(p.Files))
+	for i := range p.Files {
+		if !p.Files[i].Passthrough && p.Files[i].GitInfo != nil {
+			files = append(files, &p.Files[i])
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].GitInfo.LastCommitDate != files[j].GitInfo.LastCommitDate {
+			return files[i].GitInfo.LastCommitDate > files[j].GitInfo.LastCommitDate
+		}
+		return docPath(files[i]) < docPath(files[j])
+	})
+
+	feed := Feed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       title,
+		HomePageURL: baseURL,
+		FeedURL:     baseURL + "feed.json",
+		Items:       []FeedItem{},
+	}
+
+	for _, f := range files {
+		url := baseURL + docPath(f)
+		item := FeedItem{
+			ID:          url,
+			URL:         url,
+			Title:       p.relPath(f.Path),
+			ContentText: f.GitInfo.LastCommitMessage,
+		}
+
+		// commit dates are short dates, the feed needs RFC 3339
+		if date, err := time.Parse(time.DateOnly, f.GitInfo.LastCommitDate); err == nil {
+			item.DateModified = date.Format(time.RFC3339)
+		}
+
+		if f.GitInfo.LastAuthorName != "" {
+			item.Authors = []FeedAuthor{{Name: f.GitInfo.LastAuthorName}}
+		}
+
+		if p.RepoInfo != nil {
+			item.ExternalURL = git.GetCommitURL(p.RepoInfo, f.GitInfo.LastCommitHash)
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	return json.MarshalIndent(feed, "", "  ")
+}
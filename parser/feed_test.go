@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/kociumba/kdoc/git"
+)
+
+func TestFeedNewestFirst(t *testing.T) {
+	older := committedFile()
+	older.Path = "old.c"
+	newer := committedFile()
+	newer.Path = "new.c"
+	newer.GitInfo = &git.FileInfo{
+		LastCommitHash:    "fedcba9876543210fedcba9876543210fedcba98",
+		LastCommitDate:    "2024-06-10",
+		LastCommitMessage: "rework the layout",
+		LastAuthorName:    "John Roe",
+	}
+	p := githubParser(older, File{Path: "untracked.c"}, newer)
+
+	data, err := p.GenerateFeed("Widgets", "https://docs.example.com/", docPathOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed Feed
+	if err := json.Unmarshal(data, &feed); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []FeedItem{
+		{
+			ID:           "https://docs.example.com/new.md",
+			URL:          "https://docs.example.com/new.md",
+			Title:        "new.c",
+			ContentText:  "rework the layout",
+			DateModified: "2024-06-10T00:00:00Z",
+			Authors:      []FeedAuthor{{Name: "John Roe"}},
+			ExternalURL:  "https://github.com/acme/widgets/commit/fedcba9876543210fedcba9876543210fedcba98",
+		},
+		{
+			ID:           "https://docs.example.com/old.md",
+			URL:          "https://docs.example.com/old.md",
+			Title:        "old.c",
+			ContentText:  "fix the widget",
+			DateModified: "2024-05-01T00:00:00Z",
+			Authors:      []FeedAuthor{{Name: "Jane Doe"}},
+			ExternalURL:  "https://github.com/acme/widgets/commit/" + testHash,
+		},
+	}
+	if !reflect.DeepEqual(feed.Items, want) {
+		t.Errorf("feed items = %+v, want %+v", feed.Items, want)
+	}
+}
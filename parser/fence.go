@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/kociumba/kdoc/config"
+)
+
+// FenceLang returns the code fence token of lang for an output format ("markdown" or "html"),
+// falling back to the language itself when fence_langs has no entry
+func FenceLang(lang, format string) string {
+	if token, ok := config.CFG.FenceLangs[format][lang]; ok {
+		return token
+	}
+
+	return lang
+}
+
+// RewriteFences converts the fence tokens of a generated markdown document to the tokens of
+// another output format, used when serving the markdown pages as html
+func RewriteFences(doc, format string) string {
+	if len(config.CFG.FenceLangs[format]) == 0 {
+		return doc
+	}
+
+	// markdown tokens back to languages
+	langs := make(map[string]string)
+	for lang, token := range config.CFG.FenceLangs["markdown"] {
+		langs[token] = lang
+	}
+
+	lines := strings.Split(doc, "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+
+		marker := fenceMarker(trimmed)
+		if marker == "" {
+			continue
+		}
+		fence = marker
+
+		token := strings.TrimSpace(trimmed[len(marker):])
+		if token == "" {
+			continue
+		}
+
+		lang := token
+		if l, ok := langs[token]; ok {
+			lang = l
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		lines[i] = indent + marker + FenceLang(lang, format)
+	}
+
+	return strings.Join(lines, "\n")
+}
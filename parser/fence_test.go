@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kociumba/kdoc/config"
+)
+
+func TestFenceLangPerFormat(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.FenceLangs = config.FenceLangMap{
+			"markdown": {"cpp": "c++"},
+			"html":     {"cpp": "language-cpp"},
+		}
+	})
+
+	md := renderSource(t, "x.cpp", "cpp", "/// module\n\n/// draws\nvoid draw(int x);\n\n/// sets up\n/// @lang c\nvoid init(void);\n")
+	if !strings.Contains(md, "```c++\nvoid draw(int x)\n```") {
+		t.Errorf("markdown fence of cpp isn't c++:\n%s", md)
+	}
+
+	html := RewriteFences(md, "html")
+	if !strings.Contains(html, "```language-cpp\nvoid draw(int x)\n```") {
+		t.Errorf("html fence of cpp isn't language-cpp:\n%s", html)
+	}
+	// languages without an entry keep their name in both formats
+	if !strings.Contains(md, "```c\nvoid init(void)\n```") || !strings.Contains(html, "```c\nvoid init(void)\n```") {
+		t.Errorf("the c fence changed:\n%s", html)
+	}
+}
@@ -0,0 +1,314 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/kociumba/kdoc/config"
+)
+
+// GenerateIndex builds the project index listing every documented file with a short summary,
+// docPath maps a file to its output path relative to the output root
+func (p *Parser) GenerateIndex(docPath func(f *File) string) string {
+	return p.generateIndex("Index", "", docPath, func(f *File) bool { return true })
+}
+
+// GenerateReadmeIndex is GenerateIndex with intro, usually the project README, as the page body,
+// the generated listing follows below it under its own heading
+func (p *Parser) GenerateReadmeIndex(intro string, docPath func(f *File) string) string {
+	return p.generateIndex("Index", intro, docPath, func(f *File) bool { return true })
+}
+
+// Languages returns the sorted languages of all parsed (non passthrough) files
+func (p *Parser) Languages() []string {
+	seen := make(map[string]bool)
+	var langs []string
+	for _, f := range p.Files {
+		if !f.Passthrough && f.Language != "" && !seen[f.Language] {
+			seen[f.Language] = true
+			langs = append(langs, f.Language)
+		}
+	}
+	sort.Strings(langs)
+
+	return langs
+}
+
+// GenerateLanguageIndex is the project index limited to files of a single language
+func (p *Parser) GenerateLanguageIndex(lang string, docPath func(f *File) string) string {
+	return p.generateIndex(fmt.Sprintf("Index (%s)", lang), "", docPath, func(f *File) bool {
+		return !f.Passthrough && f.Language == lang
+	})
+}
+
+func (p *Parser) generateIndex(title, intro string, docPath func(f *File) string, include func(f *File) bool) string {
+	files := make([]*File, 0, len(p.Files))
+	for i := range p.Files {
+		if include(&p.Files[i]) {
+			files = append(files, &p.Files[i])
+		}
+	}
+	p.sortFiles(files, docPath)
+
+	var sb strings.Builder
+	if intro = strings.TrimSpace(intro); intro != "" {
+		sb.WriteString(intro + "\n\n")
+		sb.WriteString(fmt.Sprintf("## %s\n\n", title))
+	} else {
+		sb.WriteString(fmt.Sprintf("# %s\n\n", title))
+	}
+
+	if config.CFG.IndexStyle == "namespace" {
+		root := &namespaceNode{children: make(map[string]*namespaceNode)}
+		for _, f := range files {
+			if f.Passthrough {
+				continue
+			}
+
+			link := docPath(f)
+			for _, e := range visibleElements(f.Elements, "index") {
+				root.add(e.Namespace, fmt.Sprintf("[%s](%s#%s)", e.ID, link, Anchor(e.ID)))
+			}
+		}
+		root.write(&sb, "", 0)
+		sb.WriteString("\n")
+
+		return finishDocument(sb.String())
+	}
+
+	anchored := make(map[string]bool)
+	for _, f := range files {
+		link := docPath(f)
+		name := path.Join(path.Dir(link), filepath.Base(f.Path))
+		sb.WriteString("- ")
+		if config.CFG.ShowBreadcrumbs {
+			for dir := path.Dir(link); dir != "."; dir = path.Dir(dir) {
+				if !anchored[dir] {
+					anchored[dir] = true
+					sb.WriteString(fmt.Sprintf("<a id=\"%s\"></a>", dirAnchor(dir)))
+				}
+			}
+		}
+		sb.WriteString(fmt.Sprintf("[%s](%s)", name, link))
+		if config.CFG.IndexCommitHash {
+			if ref := p.commitRef(f); ref != "" {
+				sb.WriteString(" " + ref)
+			}
+		}
+		if f.Todos > 0 {
+			sb.WriteString(fmt.Sprintf(" `%d TODO`", f.Todos))
+		}
+		if summary := summaryLine(f.ModuleDesc); summary != "" {
+			sb.WriteString(" - " + summary)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+
+	return finishDocument(sb.String())
+}
+
+// one level of the namespace tree of the index, symbols keep the order of the files and elements
+type namespaceNode struct {
+	children map[string]*namespaceNode
+	symbols  []string
+}
+
+func (n *namespaceNode) add(namespace, symbol string) {
+	node := n
+	if namespace != "" {
+		for _, name := range strings.Split(namespace, "::") {
+			child, ok := node.children[name]
+			if !ok {
+				child = &namespaceNode{children: make(map[string]*namespaceNode)}
+				node.children[name] = child
+			}
+			node = child
+		}
+	}
+	node.symbols = append(node.symbols, symbol)
+}
+
+// writes the symbols of the node followed by its namespaces sorted by name, each namespace
+// is labeled with its qualified name and nests its content one level deeper
+func (n *namespaceNode) write(sb *strings.Builder, qualified string, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, symbol := range n.symbols {
+		sb.WriteString(indent + "- " + symbol + "\n")
+	}
+
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		full := name
+		if qualified != "" {
+			full = qualified + "::" + name
+		}
+		sb.WriteString(fmt.Sprintf("%s- `%s`\n", indent, full))
+		n.children[name].write(sb, full, depth+1)
+	}
+}
+
+// sorts files the way the indexes list them, by index_order and then by output path
+func (p *Parser) sortFiles(files []*File, docPath func(f *File) string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		ri, rj := p.indexRank(files[i]), p.indexRank(files[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return docPath(files[i]) < docPath(files[j])
+	})
+}
+
+// position of the first index_order glob matching the source path relative to the scan root,
+// unlisted files rank after every listed one
+func (p *Parser) indexRank(f *File) int {
+	rel := p.relPath(f.Path)
+	for i, pattern := range config.CFG.IndexOrder {
+		if matched, _ := doublestar.Match(pattern, rel); matched {
+			return i
+		}
+	}
+
+	return len(config.CFG.IndexOrder)
+}
+
+// first non empty line of a description, with markdown heading and quote markers removed,
+// links are reduced to their text since they are relative to the file page
+func summaryLine(desc string) string {
+	for _, line := range strings.Split(desc, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#>"))
+		if line != "" {
+			return mdLinkRe.ReplaceAllString(line, "$1")
+		}
+	}
+
+	return ""
+}
+
+var mdLinkRe = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+
+type symbolEntry struct {
+	ID     string
+	File   string
+	Link   string
+	Commit string
+}
+
+// GenerateSymbolIndex builds an A-Z index of every documented element,
+// docPath maps a file to its output path relative to the output root
+func (p *Parser) GenerateSymbolIndex(docPath func(f *File) string) string {
+	groups := make(map[string][]symbolEntry)
+	for i := range p.Files {
+		f := &p.Files[i]
+		if f.Passthrough {
+			continue
+		}
+
+		link := docPath(f)
+		commit := ""
+		if config.CFG.IndexCommitHash {
+			commit = p.commitRef(f)
+		}
+		for _, e := range visibleElements(f.Elements, "index") {
+			letter := "#"
+			if r := []rune(e.ID); len(r) > 0 && unicode.IsLetter(r[0]) {
+				letter = string(unicode.ToUpper(r[0]))
+			}
+
+			groups[letter] = append(groups[letter], symbolEntry{
+				ID:     e.ID,
+				File:   path.Join(path.Dir(link), filepath.Base(f.Path)),
+				Link:   fmt.Sprintf("%s#%s", link, Anchor(e.ID)),
+				Commit: commit,
+			})
+		}
+	}
+
+	letters := make([]string, 0, len(groups))
+	for letter := range groups {
+		letters = append(letters, letter)
+	}
+	sort.Strings(letters)
+
+	var sb strings.Builder
+	sb.WriteString("# Symbol Index\n\n")
+
+	for _, letter := range letters {
+		entries := groups[letter]
+		sort.SliceStable(entries, func(i, j int) bool {
+			if !strings.EqualFold(entries[i].ID, entries[j].ID) {
+				return strings.ToLower(entries[i].ID) < strings.ToLower(entries[j].ID)
+			}
+			return entries[i].Link < entries[j].Link
+		})
+
+		sb.WriteString(fmt.Sprintf("## %s\n\n", letter))
+		for _, e := range entries {
+			sb.WriteString(fmt.Sprintf("- [%s](%s) - `%s`", e.ID, e.Link, e.File))
+			if e.Commit != "" {
+				sb.WriteString(" " + e.Commit)
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	return finishDocument(sb.String())
+}
+
+// SymbolJSON is one element of symbols.json
+type SymbolJSON struct {
+	ID        string `json:"id"`
+	Signature string `json:"signature,omitempty"`
+	// source path relative to the scan root
+	Source string `json:"source"`
+	// 1 based line of the doc comment start and of the signature, 0 without a signature
+	Line          int    `json:"line"`
+	SignatureLine int    `json:"signature_line"`
+	Link          string `json:"link"`
+}
+
+// GenerateSymbolJSON lists every documented element with its source position, sorted by source
+// and line, for tools that need to map the docs back to the sources
+func (p *Parser) GenerateSymbolJSON(docPath func(f *File) string) ([]byte, error) {
+	symbols := []SymbolJSON{}
+	for i := range p.Files {
+		f := &p.Files[i]
+		if f.Passthrough {
+			continue
+		}
+
+		link := docPath(f)
+		for _, e := range visibleElements(f.Elements, "json") {
+			symbols = append(symbols, SymbolJSON{
+				ID:            e.ID,
+				Signature:     e.Signature,
+				Source:        p.relPath(f.Path),
+				Line:          e.Line,
+				SignatureLine: e.SignatureLine,
+				Link:          fmt.Sprintf("%s#%s", link, Anchor(e.ID)),
+			})
+		}
+	}
+
+	sort.SliceStable(symbols, func(i, j int) bool {
+		if symbols[i].Source != symbols[j].Source {
+			return symbols[i].Source < symbols[j].Source
+		}
+		return symbols[i].Line < symbols[j].Line
+	})
+
+	return json.MarshalIndent(symbols, "", "  ")
+}
@@ -0,0 +1,232 @@
+package parser
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kociumba/kdoc/config"
+	"github.com/kociumba/kdoc/git"
+)
+
+const testHash = "0123456789abcdef0123456789abcdef01234567"
+
+func githubParser(files ...File) *Parser {
+	return &Parser{
+		Files:        files,
+		ElementIndex: make(map[string]string),
+		RepoInfo:     &git.RepoInfo{IsRepo: true, Provider: "github", RepoOwner: "acme", RepoName: "widgets"},
+	}
+}
+
+func docPathOf(f *File) string {
+	return strings.TrimSuffix(f.Path, ".c") + ".md"
+}
+
+func TestIndexCommitHash(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.IndexCommitHash = true
+		c.CommitHashLength = 7
+	})
+
+	p := githubParser(File{
+		Path:     "a.c",
+		Elements: []Element{{ID: "foo"}},
+		GitInfo:  &git.FileInfo{LastCommitHash: testHash},
+	})
+	link := "[`0123456`](https://github.com/acme/widgets/commit/" + testHash + ")"
+
+	if index := p.GenerateIndex(docPathOf); !strings.Contains(index, "- [a.c](a.md) "+link) {
+		t.Errorf("index entry has no linked short hash:\n%s", index)
+	}
+	if symbols := p.GenerateSymbolIndex(docPathOf); !strings.Contains(symbols, link) {
+		t.Errorf("symbol index entry has no linked short hash:\n%s", symbols)
+	}
+	if page := p.GenerateMarkdownForFile(&p.Files[0]); !strings.Contains(page, "*As of "+link+"*") {
+		t.Errorf("table of contents has no linked short hash:\n%s", page)
+	}
+}
+
+func TestNestedBreadcrumbs(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.ShowBreadcrumbs = true })
+
+	p := &Parser{
+		Files:        []File{{Path: "src/gfx/shader.c", ModuleDesc: "shaders"}},
+		ElementIndex: make(map[string]string),
+		DocPath:      docPathOf,
+	}
+
+	page := p.GenerateMarkdownForFile(&p.Files[0])
+	want := "[Home](../../index.md) / [src](../../index.md#dir-src) / [gfx](../../index.md#dir-src-gfx) / shader.c\n"
+	if !strings.Contains(page, want) {
+		t.Errorf("breadcrumbs of src/gfx/shader.c, want %q in:\n%s", want, page)
+	}
+
+	index := p.GenerateIndex(docPathOf)
+	for _, anchor := range []string{`<a id="dir-src"></a>`, `<a id="dir-src-gfx"></a>`} {
+		if !strings.Contains(index, anchor) {
+			t.Errorf("index misses the breadcrumb target %s:\n%s", anchor, index)
+		}
+	}
+	if issues := LintMarkdown("index.md", index); len(issues) > 0 {
+		t.Errorf("index lint issues: %v", issues)
+	}
+}
+
+func TestSymbolIndex(t *testing.T) {
+	p := &Parser{Files: []File{
+		{Path: "gfx/draw.c", Elements: []Element{{ID: "draw"}, {ID: "Blit"}}},
+		{Path: "net/sock.c", Elements: []Element{{ID: "bind"}, {ID: "_internal"}, {ID: "draw"}}},
+	}}
+
+	want := `# Symbol Index
+
+## #
+
+- [_internal](net/sock.md#_internal) - ` + "`net/sock.c`" + `
+
+## B
+
+- [bind](net/sock.md#bind) - ` + "`net/sock.c`" + `
+- [Blit](gfx/draw.md#blit) - ` + "`gfx/draw.c`" + `
+
+## D
+
+- [draw](gfx/draw.md#draw) - ` + "`gfx/draw.c`" + `
+- [draw](net/sock.md#draw) - ` + "`net/sock.c`" + `
+`
+	if got := p.GenerateSymbolIndex(docPathOf); got != want {
+		t.Errorf("symbol index:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestIndexOrder(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.IndexOrder = []string{"guide/start.c", "guide/**", "ref/*.c"} })
+
+	p := &Parser{Files: []File{
+		{Path: "a.c"},
+		{Path: "ref/api.c"},
+		{Path: "guide/install.c"},
+		{Path: "guide/start.c"},
+		{Path: "z.c"},
+	}}
+
+	index := p.GenerateIndex(docPathOf)
+	var order []string
+	for _, line := range strings.Split(index, "\n") {
+		if name, ok := strings.CutPrefix(line, "- ["); ok {
+			order = append(order, name[:strings.Index(name, "]")])
+		}
+	}
+	want := []string{"guide/start.c", "guide/install.c", "ref/api.c", "a.c", "z.c"}
+	if !slices.Equal(order, want) {
+		t.Errorf("index order = %v, want %v\n%s", order, want, index)
+	}
+}
+
+func TestSymbolJSONLines(t *testing.T) {
+	f := parseSource(t, "gfx/draw.c", "c", `/// module
+
+/// draws a widget
+/// over two lines
+void draw(int x);
+
+/// clears
+void clear(void);
+`)
+	p := &Parser{Files: []File{*f}}
+
+	data, err := p.GenerateSymbolJSON(docPathOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var symbols []SymbolJSON
+	if err := json.Unmarshal(data, &symbols); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SymbolJSON{
+		{ID: "draw", Signature: "void draw(int x)", Source: "gfx/draw.c", Line: 3, SignatureLine: 5, Link: "gfx/draw.md#draw"},
+		{ID: "clear", Signature: "void clear(void)", Source: "gfx/draw.c", Line: 7, SignatureLine: 8, Link: "gfx/draw.md#clear"},
+	}
+	if !slices.Equal(symbols, want) {
+		t.Errorf("symbols.json = %+v, want %+v", symbols, want)
+	}
+}
+
+func TestInternalVisibility(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.InternalVisibility = []string{"page"} })
+
+	f := parseSource(t, "gfx/draw.c", "c", `/// module
+
+/// draws
+void draw(int x);
+
+/// @internal
+/// scratch buffer setup
+void setup_scratch(void);
+`)
+	p := &Parser{Files: []File{*f}, ElementIndex: make(map[string]string)}
+
+	if page := p.GenerateMarkdownForFile(&p.Files[0]); !strings.Contains(page, "#### setup_scratch\n") {
+		t.Errorf("the internal element isn't on its page:\n%s", page)
+	}
+	symbols := p.GenerateSymbolIndex(docPathOf)
+	if !strings.Contains(symbols, "[draw]") || strings.Contains(symbols, "setup_scratch") {
+		t.Errorf("the symbol index should list draw but not the internal element:\n%s", symbols)
+	}
+	data, err := p.GenerateSymbolJSON(docPathOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "setup_scratch") {
+		t.Errorf("symbols.json lists the internal element:\n%s", data)
+	}
+}
+
+func TestNamespaceIndex(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.IndexStyle = "namespace" })
+
+	f := parseSource(t, "gfx/draw.cpp", "cpp", `/// module
+
+/// global helper
+void init(void);
+
+namespace gfx {
+/// draws
+void draw(int x);
+
+namespace detail {
+/// blits
+void blit(int x);
+}
+}
+`)
+	p := &Parser{Files: []File{*f}}
+
+	want := "- [init](gfx/draw.md#init)\n" +
+		"- `gfx`\n" +
+		"  - [draw](gfx/draw.md#draw)\n" +
+		"  - `gfx::detail`\n" +
+		"    - [blit](gfx/draw.md#blit)\n"
+	if index := p.GenerateIndex(func(f *File) string { return "gfx/draw.md" }); !strings.Contains(index, want) {
+		t.Errorf("want the namespace tree\n%s\nin:\n%s", want, index)
+	}
+}
+
+func TestIndexTodos(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.IndexTodos = true })
+
+	todo := parseSource(t, "todo.c", "c", "/// module\n\n// TODO: handle resize\n/// draws\nvoid draw(int x); // FIXME leaks\n")
+	clean := parseSource(t, "clean.c", "c", "/// module\n")
+	p := &Parser{Files: []File{*todo, *clean}}
+
+	index := p.GenerateIndex(docPathOf)
+	if !strings.Contains(index, "- [todo.c](todo.md) `2 TODO`") {
+		t.Errorf("todo.c isn't shown with 2 TODOs:\n%s", index)
+	}
+	if strings.Contains(index, "(clean.md) `") {
+		t.Errorf("clean.c has a TODO count:\n%s", index)
+	}
+}
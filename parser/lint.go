@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingRe    = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*$`)
+	htmlAnchorRe = regexp.MustCompile(`<a id="([^"]*)"></a>`)
+	codeSpanRe   = regexp.MustCompile("`[^`]*`")
+	openLinkRe   = regexp.MustCompile(`\]\([^)]*$`)
+)
+
+// LintMarkdown runs structural checks on a generated document, unbalanced code fences,
+// links missing their closing parenthesis and anchors defined more than once
+func LintMarkdown(path, doc string) []Issue {
+	var issues []Issue
+	add := func(line int, kind, msg string) {
+		issues = append(issues, Issue{File: path, Line: line, Element: "-", Kind: kind, Message: msg})
+	}
+
+	fence := ""
+	fenceLine := 0
+	anchors := make(map[string]int)
+	addAnchor := func(anchor string, line int) {
+		if first, ok := anchors[anchor]; ok {
+			add(line, "duplicate-anchor", fmt.Sprintf("anchor #%s already defined on line %d", anchor, first))
+			return
+		}
+		anchors[anchor] = line
+	}
+
+	for i, line := range strings.Split(doc, "\n") {
+		lineNum := i + 1
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				if strings.Trim(trimmed, fence[:1]) == "" {
+					fence = ""
+				} else {
+					// a fence with an info string can't close the open one, the fence
+					// opened earlier swallowed the rest of the section
+					add(fenceLine, "unbalanced-fence", fmt.Sprintf("code fence %s is not closed before the fence on line %d", fence, lineNum))
+					fenceLine = lineNum
+				}
+			}
+			continue
+		}
+
+		if marker := fenceMarker(trimmed); marker != "" {
+			fence = marker
+			fenceLine = lineNum
+			continue
+		}
+
+		for _, m := range htmlAnchorRe.FindAllStringSubmatch(line, -1) {
+			addAnchor(m[1], lineNum)
+		}
+
+		if m := headingRe.FindStringSubmatch(trimmed); m != nil {
+			addAnchor(Anchor(m[1]), lineNum)
+		}
+
+		if openLinkRe.MatchString(codeSpanRe.ReplaceAllString(line, "")) {
+			add(lineNum, "broken-link", "link is missing its closing parenthesis")
+		}
+	}
+
+	if fence != "" {
+		add(fenceLine, "unbalanced-fence", fmt.Sprintf("code fence %s is never closed", fence))
+	}
+
+	return issues
+}
+
+// returns the opening run of backticks or tildes of a fence line
+func fenceMarker(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+
+	return ""
+}
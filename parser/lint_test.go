@@ -0,0 +1,20 @@
+package parser
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLintUnbalancedFence(t *testing.T) {
+	md := renderSource(t, "x.c", "c", "/// module\n\n/// example:\n/// ```c\n/// foo();\nvoid foo(void);\n")
+
+	issues := LintMarkdown("x.md", md)
+	if !slices.ContainsFunc(issues, func(i Issue) bool { return i.Kind == "unbalanced-fence" }) {
+		t.Errorf("issues = %v, want the unclosed fence of the description", issues)
+	}
+
+	clean := renderSource(t, "x.c", "c", "/// module\n\n/// example:\n/// ```c\n/// foo();\n/// ```\nvoid foo(void);\n")
+	if issues := LintMarkdown("x.md", clean); len(issues) > 0 {
+		t.Errorf("balanced fences reported: %v", issues)
+	}
+}
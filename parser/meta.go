@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+)
+
+// PageMeta describes a page for the OpenGraph and Twitter tags of html output
+type PageMeta struct {
+	Title       string
+	Description string
+	Author      string
+}
+
+// PageMeta collects the metadata of the page of f, the description is the first line of the
+// module comment and the author the first @author, or the top git contributor without one
+func (p *Parser) PageMeta(f *File) PageMeta {
+	meta := PageMeta{
+		Title:       filepath.Base(f.Path),
+		Description: summaryLine(f.ModuleDesc),
+	}
+
+	if len(f.Authors) > 0 {
+		meta.Author = f.Authors[0]
+	} else if f.GitInfo != nil && len(f.GitInfo.Authors) > 0 {
+		meta.Author = f.GitInfo.Authors[0].Name
+	}
+
+	return meta
+}
+
+// HTML renders the meta tags for the html head, empty fields are left out
+func (m PageMeta) HTML() string {
+	var sb strings.Builder
+	tag := func(attr, name, content string) {
+		if content != "" {
+			sb.WriteString(fmt.Sprintf("<meta %s=\"%s\" content=\"%s\">\n", attr, name, html.EscapeString(content)))
+		}
+	}
+
+	tag("property", "og:type", "article")
+	tag("property", "og:title", m.Title)
+	tag("property", "og:description", m.Description)
+	tag("name", "description", m.Description)
+	tag("name", "author", m.Author)
+	tag("name", "twitter:card", "summary")
+	tag("name", "twitter:title", m.Title)
+	tag("name", "twitter:description", m.Description)
+
+	return sb.String()
+}
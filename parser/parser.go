@@ -1,20 +1,48 @@
 package parser
 
 import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/kociumba/kdoc/config"
 	"github.com/kociumba/kdoc/git"
+	"github.com/kociumba/kdoc/report"
+)
+
+var (
+	classRe    = regexp.MustCompile(`^(?:class|struct)\s+([\p{L}\p{M}\p{N}_]+)`)
+	funcRe     = regexp.MustCompile(`([\p{L}\p{M}\p{N}_]+)\s*\(`)
+	backlinkRe = regexp.MustCompile(`\[([^\]]+)\]`)
+	symbolRe   = regexp.MustCompile(`^[A-Za-z_][\w:.~]*$`)
+	accessRe   = regexp.MustCompile(`^(public|private|protected)\s*:`)
+	typeOpenRe = regexp.MustCompile(`^(class|struct)\s+\w+[^;]*$`)
+	goDeclRe   = regexp.MustCompile(`^(?:func\s*(?:\([^)]*\)\s*)?|(?:type|var|const)\s+)([\p{L}\p{N}_]+)`)
+	todoRe     = regexp.MustCompile(`\b(?:TODO|FIXME)\b`)
+	doxyRefRe  = regexp.MustCompile(`[@\\]ref\s+([A-Za-z_][\w:.~]*)(?:\s+"([^"]*)")?`)
+	doxyLinkRe = regexp.MustCompile(`(?s)[@\\]link\s+([A-Za-z_][\w:.~]*)(.*?)[@\\]endlink`)
 )
 
 type Parser struct {
 	Files        []File
 	ElementIndex map[string]string
 	RepoInfo     *git.RepoInfo
+	// scan root, source paths shown on pages are relative to it
+	Root string
+	// maps a file to its page relative to the output root, needed for breadcrumbs
+	DocPath func(f *File) string
 }
 
 type File struct {
@@ -23,140 +51,588 @@ type File struct {
 	ModuleDesc string
 	Elements   []Element
 	GitInfo    *git.FileInfo
+	// passthrough files are copied verbatim into the output, ModuleDesc holds the raw content
+	Passthrough bool
+	Related     []RelatedFile
+	LOC         int
+	Size        int64
+	// hex sha256 of the source content
+	Checksum string
+	// in a repository but without git history, set only when uncommitted_card is enabled
+	Uncommitted bool
+	// TODO and FIXME markers in the source, only counted with index_todos
+	Todos int
+	// declared with @author and @maintainer in the module comment
+	Authors     []string
+	Maintainers []string
+}
+
+type RelatedFile struct {
+	Name string
+	Link string
 }
 
 type Element struct {
 	ID          string
 	Description string
-	Signature   string
+	// short summary from @brief, shown in the table of contents, Description holds the rest
+	Brief     string
+	Signature string
+	// language set with @lang, overrides the file language for this element, empty otherwise,
+	// ProseLang elements take no signature and render without a fence
+	Language string
+	// 1 based source lines of the doc comment start and the signature, SignatureLine is 0 without a signature
+	Line          int
+	SignatureLine int
+	Private       bool
+	// marked @internal or a file local c/c++ declaration, static or inside an anonymous namespace
+	Internal bool
+	// qualified name of the enclosing namespaces, "outer::inner", empty at global scope
+	Namespace string
+	// section set with @group, empty for ungrouped elements
+	Group string
+	// documented with @param and @return, removed from Description
+	Params  []ParamDoc
+	Returns string
+	// best effort split of the signature, empty when the signature couldn't be split reliably
+	ReturnType string
+	FuncName   string
+	ParamList  string
 }
 
-func ParseFile(filePath string, f *File, docPrefix string, ignoreIndented bool) error {
-	f.Path = filePath
-	data, err := os.ReadFile(filePath)
+// @lang value of elements documented as prose only, they take no signature line
+const ProseLang = "none"
+
+type ParamDoc struct {
+	Name        string
+	Description string
+}
+
+func ParseFile(filePath string, f *File, docPrefixes []string, ignoreIndented bool) error {
+	data, err := ReadSource(filePath)
 	if err != nil {
 		return err
 	}
 
-	lines := strings.Split(string(data), "\n")
-	f.ModuleDesc, lines = extractTopComment(lines, docPrefix, ignoreIndented)
-	f.Elements, _ = extractElements(lines, docPrefix, ignoreIndented)
+	ParseContent(filePath, data, f, docPrefixes, ignoreIndented)
+	return nil
+}
+
+// ParseContent parses already loaded source, filePath is only used for naming and messages
+func ParseContent(filePath string, data []byte, f *File, docPrefixes []string, ignoreIndented bool) {
+	f.Path = filePath
+	// a utf-8 bom would hide the doc prefix of the first line
+	content := strings.TrimPrefix(string(data), "\uFEFF")
+	// crlf files would otherwise keep a \r on every line, in descriptions and signatures alike
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	f.Size = int64(len(data))
+	f.Checksum = checksum(data)
+	if config.CFG.IndexTodos {
+		f.Todos = len(todoRe.FindAllIndex(data, -1))
+	}
+	f.LOC = countLOC(lines)
+	total := len(lines)
+	f.ModuleDesc, lines = extractTopComment(lines, docPrefixes, ignoreIndented)
+
+	var tags map[string][]string
+	f.ModuleDesc, tags = takeTags(f.ModuleDesc, "author", "maintainer")
+	f.Authors = splitNames(tags["author"])
+	f.Maintainers = splitNames(tags["maintainer"])
+
+	f.Elements, _ = extractElements(lines, total-len(lines), docPrefixes, ignoreIndented, f.Language)
+
+	for i, e := range f.Elements {
+		if e.ID == unnamedID(i) {
+			report.Warnf("Warning: no ID found for the element at %s:%d, using %s", filePath, e.Line, e.ID)
+		}
+	}
+
+	if config.CFG.OnlyExported {
+		f.Elements = slices.DeleteFunc(f.Elements, func(e Element) bool { return e.Private })
+	}
+
+	if config.CFG.InternalSymbols == "skip" {
+		f.Elements = slices.DeleteFunc(f.Elements, func(e Element) bool { return e.Internal })
+	}
+}
+
+var ErrReadFailed = errors.New("failed to read source file")
+
+// ReadError is returned when reading a source file fails, it keeps the message of the
+// underlying error and matches ErrReadFailed with errors.Is
+type ReadError struct {
+	Path string
+	Err  error
+}
+
+func (e *ReadError) Error() string { return e.Err.Error() }
 
+func (e *ReadError) Unwrap() error { return e.Err }
+
+func (e *ReadError) Is(target error) bool { return target == ErrReadFailed }
+
+// reads source files, replaced in tests to simulate failing filesystems
+var readFile = os.ReadFile
+
+// ReadSource reads a file retrying transient failures (e.g. stale NFS handles) up to config.CFG.ReadRetries times
+// with exponential backoff, a missing file is never retried
+func ReadSource(path string) ([]byte, error) {
+	delay := 50 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		data, err := readFile(path)
+		if err != nil && (attempt >= config.CFG.ReadRetries || errors.Is(err, fs.ErrNotExist)) {
+			return nil, &ReadError{Path: path, Err: err}
+		}
+		if err == nil {
+			return data, nil
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// counts non blank lines
+func countLOC(lines []string) int {
+	loc := 0
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			loc++
+		}
+	}
+
+	return loc
+}
+
+func ReadPassthrough(filePath string, f *File) error {
+	data, err := ReadSource(filePath)
+	if err != nil {
+		return err
+	}
+
+	PassthroughContent(filePath, data, f)
 	return nil
 }
 
-func extractTopComment(lines []string, prefix string, ignoreIndented bool) (string, []string) {
-	var desc []string
-	i := 0
-	prefixLen := len(prefix)
+func PassthroughContent(filePath string, data []byte, f *File) {
+	f.Path = filePath
+	f.Passthrough = true
+	f.ModuleDesc = string(data)
+}
 
-	for i < len(lines) {
-		line := lines[i]
-		trimmedLine := strings.TrimSpace(line)
+var (
+	prefixReMu    sync.Mutex
+	prefixReCache = make(map[string]*regexp.Regexp)
+)
 
-		if !strings.HasPrefix(trimmedLine, prefix) {
-			break
+// compiles a doc_comment regex anchored at the start of the line, invalid patterns are reported
+// once and never match
+func prefixRegexp(prefix string) *regexp.Regexp {
+	prefixReMu.Lock()
+	defer prefixReMu.Unlock()
+
+	re, ok := prefixReCache[prefix]
+	if !ok {
+		var err error
+		re, err = regexp.Compile("^(?:" + strings.TrimPrefix(prefix, "^") + ")")
+		if err != nil {
+			report.Warnf("Warning: invalid doc_comment regex %q: %v", prefix, err)
 		}
+		prefixReCache[prefix] = re
+	}
 
-		if ignoreIndented {
-			prefixPos := strings.Index(line, prefix)
-			if prefixPos > 0 && strings.TrimSpace(line[:prefixPos]) == "" {
-				i++
-				continue
-			}
+	return re
+}
+
+// returns the content of a trimmed doc comment line, when several prefixes match the longest
+// one is stripped so "///" wins over "//"
+func docLine(trimmedLine string, prefixes []string) (string, bool) {
+	content, matched := "", -1
+	for _, prefix := range prefixes {
+		if c, n, ok := cutDocPrefix(trimmedLine, prefix); ok && n > matched {
+			content, matched = c, n
 		}
+	}
+
+	if matched < 0 {
+		return "", false
+	}
+
+	if len(content) > 0 && content[0] == ' ' {
+		content = content[1:]
+	}
+
+	return content, true
+}
+
+// matches a single prefix, with doc_comment_is_regex the prefix is a regex whose first capture
+// group is the content, or everything after the match without one, n is the matched length
+func cutDocPrefix(trimmedLine, prefix string) (content string, n int, ok bool) {
+	if !config.CFG.DocCommentIsRegex {
+		content, ok = strings.CutPrefix(trimmedLine, prefix)
+		return content, len(prefix), ok
+	}
+
+	re := prefixRegexp(prefix)
+	if re == nil {
+		return "", 0, false
+	}
+
+	m := re.FindStringSubmatchIndex(trimmedLine)
+	if m == nil {
+		return "", 0, false
+	}
+
+	if len(m) >= 4 && m[2] >= 0 {
+		return trimmedLine[m[2]:m[3]], m[1], true
+	}
+	return trimmedLine[m[1]:], m[1], true
+}
+
+// docLine on an untrimmed line, with strict_column_zero indented lines are never doc comments
+func rawDocLine(line string, prefixes []string) (string, bool) {
+	if config.CFG.StrictColumnZero && isColumnIndented(line) {
+		return "", false
+	}
+
+	return docLine(strings.TrimSpace(line), prefixes)
+}
+
+func isDocLine(line string, prefixes []string) bool {
+	_, ok := rawDocLine(line, prefixes)
+	return ok
+}
 
-		content := trimmedLine[prefixLen:]
+func isColumnIndented(line string) bool {
+	return line != strings.TrimLeft(line, " \t")
+}
+
+// like isIndented for the doc comment prefixes, a regex prefix has no literal marker to find
+// so any leading whitespace counts
+func isIndentedDoc(line string, prefixes []string) bool {
+	if config.CFG.DocCommentIsRegex {
+		return indentWidth(line) > config.CFG.IndentThreshold
+	}
+
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(trimmed, prefix) && isIndented(line, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reports whether marker is preceded by more than indent_threshold columns of whitespace
+func isIndented(line, marker string) bool {
+	pos := strings.Index(line, marker)
+	return pos > 0 && strings.TrimSpace(line[:pos]) == "" && indentWidth(line[:pos]) > config.CFG.IndentThreshold
+}
+
+// columns of the leading whitespace of line, tabs advance to the next multiple of 4
+func indentWidth(line string) int {
+	width := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += 4 - width%4
+		default:
+			return width
+		}
+	}
+
+	return width
+}
+
+// reads a block doc comment (like /** ... */) starting at lines[i], returns the content lines
+// with the leading "*" decoration removed and the index of the first line after the comment
+func readBlockComment(lines []string, i int, ignoreIndented bool) ([]string, int, bool) {
+	start, end := config.CFG.BlockCommentStart, config.CFG.BlockCommentEnd
+	if start == "" || end == "" || i >= len(lines) {
+		return nil, i, false
+	}
+
+	line := lines[i]
+	trimmedLine := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmedLine, start) {
+		return nil, i, false
+	}
+
+	if ignoreIndented && isIndented(line, start) || config.CFG.StrictColumnZero && isColumnIndented(line) {
+		return nil, i, false
+	}
+
+	var desc []string
+	rest := trimmedLine[len(start):]
+	for {
+		closed := false
+		if idx := strings.Index(rest, end); idx != -1 {
+			rest = rest[:idx]
+			closed = true
+		}
+
+		content := strings.TrimSpace(rest)
+		content = strings.TrimPrefix(content, "*")
 		if len(content) > 0 && content[0] == ' ' {
 			content = content[1:]
 		}
-
 		desc = append(desc, content)
 		i++
+
+		if closed || i >= len(lines) {
+			break
+		}
+		rest = lines[i]
 	}
 
-	return strings.Join(desc, "\n"), lines[i:]
+	for len(desc) > 0 && desc[0] == "" {
+		desc = desc[1:]
+	}
+	for len(desc) > 0 && desc[len(desc)-1] == "" {
+		desc = desc[:len(desc)-1]
+	}
+
+	return desc, i, true
 }
 
-func extractElements(lines []string, prefix string, ignoreIndented bool) ([]Element, []string) {
-	var elements []Element
+// reports whether line opens a block doc comment
+func isBlockStart(line string) bool {
+	start := config.CFG.BlockCommentStart
+	return start != "" && config.CFG.BlockCommentEnd != "" && strings.HasPrefix(strings.TrimSpace(line), start)
+}
+
+func extractTopComment(lines []string, prefixes []string, ignoreIndented bool) (string, []string) {
+	if desc, next, ok := readBlockComment(lines, 0, ignoreIndented); ok {
+		return strings.Join(desc, "\n"), lines[next:]
+	}
+
+	var desc []string
 	i := 0
-	prefixLen := len(prefix)
 
 	for i < len(lines) {
 		line := lines[i]
-		trimmedLine := strings.TrimSpace(line)
+		content, ok := rawDocLine(line, prefixes)
+		if !ok {
+			break
+		}
 
-		if !strings.HasPrefix(trimmedLine, prefix) {
+		if ignoreIndented && isIndentedDoc(line, prefixes) {
 			i++
 			continue
 		}
 
-		if ignoreIndented {
-			prefixPos := strings.Index(line, prefix)
-			if prefixPos > 0 && strings.TrimSpace(line[:prefixPos]) == "" {
+		desc = append(desc, content)
+		i++
+	}
+
+	return strings.Join(desc, "\n"), lines[i:]
+}
+
+// fallback ID of the n-th element of a file when neither the signature nor @name give one
+func unnamedID(n int) string {
+	return fmt.Sprintf("%s%d", config.CFG.UnnamedIDPrefix, n)
+}
+
+// offset is the number of lines preceding lines in the source file, used for line numbers
+func extractElements(lines []string, offset int, prefixes []string, ignoreIndented bool, lang string) ([]Element, []string) {
+	var elements []Element
+	i := 0
+	access := "public"
+	// access labels only exist in c++, classes of other languages must not hide the code after them
+	tracksAccess := lang == "c" || lang == "cpp"
+	var scope scopeTracker
+
+	for i < len(lines) {
+		line := lines[i]
+		trimmedLine := strings.TrimSpace(line)
+		start := i
+
+		// block and line comments are checked on every line, so both styles can be mixed in one file
+		desc, next, isBlock := readBlockComment(lines, i, ignoreIndented)
+		if isBlock {
+			i = next
+		} else {
+			if _, ok := rawDocLine(line, prefixes); !ok {
+				if tracksAccess {
+					access = updateAccess(trimmedLine, access)
+				}
+				scope.track(line)
 				i++
 				continue
 			}
-		}
-
-		var desc []string
-		for i < len(lines) {
-			line := lines[i]
-			trimmedLine := strings.TrimSpace(line)
 
-			if !strings.HasPrefix(trimmedLine, prefix) {
-				break
+			if ignoreIndented && isIndentedDoc(line, prefixes) {
+				i++
+				continue
 			}
 
-			content := trimmedLine[prefixLen:]
-			if len(content) > 0 && content[0] == ' ' {
-				content = content[1:]
-			}
+			for i < len(lines) {
+				content, ok := rawDocLine(lines[i], prefixes)
+				if !ok {
+					break
+				}
 
-			desc = append(desc, content)
-			i++
+				desc = append(desc, content)
+				i++
+			}
 		}
 
 		if len(desc) == 0 {
 			continue
 		}
 
-		descMD := strings.Join(desc, "\n")
+		descMD, tags := takeTags(strings.Join(desc, "\n"), "brief", "lang", "internal", "name", "group", "param", "return", "returns")
+		elemLang := ""
+		if langs := tags["lang"]; len(langs) > 0 {
+			elemLang = langs[len(langs)-1]
+		}
+		sigLang := cmp.Or(elemLang, lang)
 
-		for i < len(lines) && (strings.TrimSpace(lines[i]) == "" || strings.HasPrefix(strings.TrimSpace(lines[i]), prefix)) {
+		// a block comment after the gap is the next element's doc, not this one's signature
+		gap := 0
+		for i < len(lines) && !isBlockStart(lines[i]) && (strings.TrimSpace(lines[i]) == "" || isDocLine(lines[i], prefixes)) {
+			if strings.TrimSpace(lines[i]) == "" {
+				gap++
+			}
 			i++
 		}
 
+		// too far from the next declaration, the comment stands on its own, as do prose-only
+		// comments which have no declaration to show
+		standalone := config.CFG.MaxGapLines >= 0 && gap > config.CFG.MaxGapLines || i < len(lines) && isBlockStart(lines[i]) ||
+			elemLang == ProseLang
+
 		sig := ""
-		if i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+		sigLine := 0
+		sigAccess := access
+		internal := false
+		namespace := scope.namespace()
+		if !standalone && i < len(lines) && strings.TrimSpace(lines[i]) != "" {
 			sig = strings.TrimSpace(lines[i])
-			sig = regexp.MustCompile(`\s*{$`).ReplaceAllString(sig, "")
+			internal = (sigLang == "c" || sigLang == "cpp") && scope.internal(sig)
+			scope.track(sig)
+			if tracksAccess {
+				access = updateAccess(sig, access)
+			}
+			sig = trimSignature(sig, sigLang)
+			sigLine = offset + i + 1
 			i++
 		}
 
+		// an explicit @name wins over the signature for declarations the heuristics can't name
 		id := extractIDFromSig(sig)
-		if id == "" {
-			id = fmt.Sprintf("unnamed_%d", len(elements))
+		if names := tags["name"]; len(names) > 0 && names[len(names)-1] != "" {
+			id = names[len(names)-1]
+		} else if id == "" {
+			id = unnamedID(len(elements))
 		}
 
 		elements = append(elements, Element{
-			ID:          id,
-			Description: descMD,
-			Signature:   sig,
+			ID:            id,
+			Description:   descMD,
+			Brief:         strings.Join(tags["brief"], " "),
+			Signature:     sig,
+			Language:      elemLang,
+			Line:          offset + start + 1,
+			SignatureLine: sigLine,
+			Private:       isPrivate(id, sig, sigAccess, lang),
+			Internal:      internal || tags["internal"] != nil,
+			Namespace:     namespace,
+			Group:         strings.Join(tags["group"], " "),
+			Params:        parseParams(tags["param"]),
+			Returns:       strings.Join(append(tags["return"], tags["returns"]...), " "),
 		})
+
+		last := &elements[len(elements)-1]
+		if ret, name, params, ok := splitSignature(sig, sigLang); ok {
+			last.ReturnType, last.FuncName, last.ParamList = ret, name, params
+		}
 	}
 
 	return elements, lines[i:]
 }
 
+// best effort tracking of c++ access labels, class bodies start private and struct bodies public,
+// the access resets when a type body is closed
+func updateAccess(line, access string) string {
+	if m := accessRe.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+
+	if m := typeOpenRe.FindStringSubmatch(line); m != nil {
+		if m[1] == "class" {
+			return "private"
+		}
+		return "public"
+	}
+
+	if strings.HasPrefix(line, "};") {
+		return "public"
+	}
+
+	return access
+}
+
+// an element is private if it follows a private/protected label, uses a configured private prefix
+// or is an unexported go identifier
+func isPrivate(id, sig, access, lang string) bool {
+	if access != "public" {
+		return true
+	}
+
+	for _, prefix := range config.CFG.PrivatePrefixes {
+		if prefix != "" && strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+
+	if lang == "go" {
+		r := []rune(goDeclName(sig, id))
+		return len(r) > 0 && unicode.IsLower(r[0])
+	}
+
+	return false
+}
+
+// the declared name of a go declaration, the identifier after type, var or const and after the
+// receiver of methods, the fallback ID would be the keyword itself for most of them
+func goDeclName(sig, id string) string {
+	if m := goDeclRe.FindStringSubmatch(sig); m != nil {
+		return m[1]
+	}
+
+	return id
+}
+
+// strips trailing tokens like "{", ":" or ";" from a signature, the tokens are picked per language
+// and stripped repeatedly so "() => {" ends up as "()"
+func trimSignature(sig, lang string) string {
+	tokens, ok := config.CFG.SignatureTrim[lang]
+	if !ok {
+		tokens = config.CFG.SignatureTrim["default"]
+	}
+
+	for {
+		trimmed := sig
+		for _, tok := range tokens {
+			trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, tok))
+		}
+
+		if trimmed == sig {
+			return sig
+		}
+		sig = trimmed
+	}
+}
+
 func extractIDFromSig(sig string) string {
-	classRe := regexp.MustCompile(`^(?:class|struct)\s+(\w+)`)
 	if matches := classRe.FindStringSubmatch(sig); len(matches) > 1 {
 		return matches[1]
 	}
 
-	funcRe := regexp.MustCompile(`(\w+)\s*\(`)
 	if matches := funcRe.FindStringSubmatch(sig); len(matches) > 1 {
 		return matches[1]
 	}
@@ -169,38 +645,197 @@ func extractIDFromSig(sig string) string {
 	return ""
 }
 
-func ProcessBacklinks(desc string, linkIndex map[string]string, prefix string) string {
-	re := regexp.MustCompile(`\[([^\]]+)\]`)
-	return re.ReplaceAllStringFunc(desc, func(match string) string {
-		submatch := re.FindStringSubmatch(match)
-		if len(submatch) == 2 {
-			targetID := submatch[1]
-			if link, ok := linkIndex[targetID]; ok {
-				return fmt.Sprintf("[%s](%s)", targetID, link)
+// Anchor returns the markdown heading anchor for an element ID, by default the way GitHub
+// slugs headings: lowercased, letters, numbers and marks of any script kept, spaces turned
+// into dashes and other punctuation dropped, so "std::vector" becomes "stdvector"
+func Anchor(id string) string {
+	if config.CFG.AnchorStyle == "simple" {
+		return strings.ToLower(strings.ReplaceAll(id, " ", "-"))
+	}
+
+	var sb strings.Builder
+	for _, r := range strings.ToLower(id) {
+		switch {
+		case r == ' ':
+			sb.WriteRune('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r):
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+// ProcessBacklinks turns [ID] and doxygen references into links, linkIndex maps IDs to
+// "page.md#anchor" relative to the output root and from is the page of desc, also relative to
+// the output root, which the links are made relative to
+func ProcessBacklinks(desc string, linkIndex map[string]string, from string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range backlinkRe.FindAllStringSubmatchIndex(desc, -1) {
+		// the text of an inline markdown link [text](url) is no backlink
+		if m[1] < len(desc) && desc[m[1]] == '(' {
+			continue
+		}
+
+		targetID := desc[m[2]:m[3]]
+		link, ok := resolveRef(targetID, linkIndex, from)
+		if !ok {
+			if symbolRe.MatchString(targetID) {
+				report.Warnf("Warning: unresolved backlink [%s]", targetID)
 			}
+			continue
+		}
+
+		// qualified [path#ID] references only show the ID
+		text := targetID
+		if _, id, ok := strings.Cut(targetID, "#"); ok {
+			text = id
 		}
 
-		return match
+		sb.WriteString(desc[last:m[0]])
+		sb.WriteString(fmt.Sprintf("[%s](%s)", text, link))
+		last = m[1]
+	}
+	sb.WriteString(desc[last:])
+
+	return processDoxygenRefs(sb.String(), linkIndex, from)
+}
+
+// local symbols take precedence, external ones only fill in the gaps
+func resolveRef(id string, linkIndex map[string]string, from string) (string, bool) {
+	if link, ok := linkIndex[id]; ok {
+		return relativeLink(from, link), true
+	}
+
+	link, ok := config.CFG.ExternalRefs[id]
+	return link, ok
+}
+
+// rebases a link relative to the output root on the directory of the page from,
+// "sub/b.md#x" seen from "other/a.md" becomes "../sub/b.md#x"
+func relativeLink(from, link string) string {
+	target, frag, _ := strings.Cut(link, "#")
+	rel, err := filepath.Rel(path.Dir(from), target)
+	if err != nil {
+		return link
+	}
+
+	rel = filepath.ToSlash(rel)
+	if frag != "" {
+		rel += "#" + frag
+	}
+
+	return rel
+}
+
+// converts doxygen @ref Name, @ref Name "text" and @link Name text @endlink into links,
+// unresolved references are reported and reduced to their text, runs after the [ID] pass so
+// the generated links aren't matched again
+func processDoxygenRefs(desc string, linkIndex map[string]string, from string) string {
+	if !strings.Contains(desc, "ref") && !strings.Contains(desc, "link") {
+		return desc
+	}
+
+	replace := func(id, text, suffix string) string {
+		if link, ok := resolveRef(id, linkIndex, from); ok {
+			return fmt.Sprintf("[%s](%s)%s", text, link, suffix)
+		}
+
+		report.Warnf("Warning: unresolved reference %s", id)
+		return text + suffix
+	}
+
+	desc = doxyLinkRe.ReplaceAllStringFunc(desc, func(match string) string {
+		m := doxyLinkRe.FindStringSubmatch(match)
+		return replace(m[1], cmp.Or(strings.TrimSpace(m[2]), m[1]), "")
+	})
+
+	return doxyRefRe.ReplaceAllStringFunc(desc, func(match string) string {
+		m := doxyRefRe.FindStringSubmatch(match)
+		// a sentence ending right after the name keeps its period
+		id := strings.TrimRight(m[1], ".")
+		suffix := m[1][len(id):]
+		if m[2] != "" {
+			return replace(id, m[2], suffix)
+		}
+		return replace(id, id, suffix)
 	})
 }
 
 func (p *Parser) GenerateMarkdownForFile(f *File) string {
+	if f.Passthrough {
+		return f.ModuleDesc
+	}
+
+	elements, grouped := groupElements(visibleElements(f.Elements, "page"))
+
 	var sb strings.Builder
 	base := filepath.Base(f.Path)
+	sb.WriteString(frontMatter(f))
+	if config.CFG.ShowBreadcrumbs && p.DocPath != nil {
+		sb.WriteString(breadcrumbs(p.DocPath(f), base))
+	}
 	sb.WriteString(fmt.Sprintf("# %s\n\n", base))
 
-	if f.GitInfo != nil && p.RepoInfo != nil && p.RepoInfo.IsRepo {
+	if config.CFG.GitCard && f.GitInfo != nil && p.RepoInfo != nil && p.RepoInfo.IsRepo && f.GitInfo.TotalCommits >= config.CFG.MinCommitsForCard {
 		sb.WriteString(p.generateGitMetadata(f))
+	} else if config.CFG.GitCard && f.Uncommitted {
+		sb.WriteString(generateUncommittedCard())
+	} else if config.CFG.ShowFileStats {
+		sb.WriteString(fmt.Sprintf("*%s*\n\n", formatStats(f)))
+	}
+
+	if f.GitInfo != nil && len(f.GitInfo.Recent) > 0 {
+		sb.WriteString(p.recentCommits(f))
+	}
+
+	if len(f.Authors) > 0 {
+		sb.WriteString(fmt.Sprintf("**Authors:** %s\n\n", strings.Join(f.Authors, ", ")))
+	}
+
+	if len(f.Maintainers) > 0 {
+		sb.WriteString(fmt.Sprintf("**Maintainers:** %s\n\n", strings.Join(f.Maintainers, ", ")))
 	}
 
 	if f.ModuleDesc != "" {
+		if config.CFG.ModuleHeading != "" {
+			sb.WriteString(fmt.Sprintf("## %s\n\n", config.CFG.ModuleHeading))
+		}
 		sb.WriteString(f.ModuleDesc + "\n\n")
 	}
 
-	if len(f.Elements) > 0 {
+	if f.ModuleDesc == "" && len(elements) == 0 && len(f.Authors) == 0 && len(f.Maintainers) == 0 && config.CFG.EmptyPlaceholder != "" {
+		sb.WriteString(config.CFG.EmptyPlaceholder + "\n\n")
+	}
+
+	var moduleHeadings []heading
+	if config.CFG.TOCModuleHeadings {
+		moduleHeadings = findHeadings(f.ModuleDesc)
+	}
+
+	if len(elements) > 0 || len(moduleHeadings) > 0 {
 		sb.WriteString("## Table of Contents\n\n")
-		for _, e := range f.Elements {
-			anchor := strings.ToLower(strings.ReplaceAll(e.ID, " ", "-"))
+		if config.CFG.IndexCommitHash {
+			if ref := p.commitRef(f); ref != "" {
+				sb.WriteString(fmt.Sprintf("*As of %s*\n\n", ref))
+			}
+		}
+		for _, h := range moduleHeadings {
+			sb.WriteString(fmt.Sprintf("%s- [%s](#%s)\n", strings.Repeat("  ", h.Level), h.Text, Anchor(h.Text)))
+		}
+		group := ""
+		for _, e := range elements {
+			indent := ""
+			if grouped {
+				if e.Group != group {
+					group = e.Group
+					sb.WriteString(fmt.Sprintf("- [%s](#%s)\n", group, Anchor(group)))
+				}
+				indent = "  "
+			}
+
+			anchor := Anchor(e.ID)
 			linkText := e.ID
 			if e.Signature != "" {
 				sig := strings.SplitN(strings.TrimSpace(e.Signature), "\n", 2)[0]
@@ -209,21 +844,384 @@ func (p *Parser) GenerateMarkdownForFile(f *File) string {
 				linkText = fmt.Sprintf("%s `%s`", e.ID, sig)
 			}
 
-			sb.WriteString(fmt.Sprintf("- [%s](#%s)\n", linkText, anchor))
+			sb.WriteString(fmt.Sprintf("%s- [%s](#%s)", indent, linkText, anchor))
+			if e.Brief != "" {
+				sb.WriteString(" - " + e.Brief)
+			}
+			sb.WriteString("\n")
 		}
 		sb.WriteString("\n")
 	}
 
-	for _, e := range f.Elements {
-		sb.WriteString(fmt.Sprintf("#### %s\n\n", e.ID))
+	group := ""
+	for i, e := range elements {
+		if i > 0 && config.CFG.ElementSeparator != "" {
+			sb.WriteString(config.CFG.ElementSeparator + "\n\n")
+		}
+
+		if grouped && e.Group != group {
+			group = e.Group
+			sb.WriteString(fmt.Sprintf("### %s\n\n", group))
+		}
+
+		if config.CFG.ElementMarkers {
+			sb.WriteString(fmt.Sprintf("<!-- kdoc:element id=%s file=%s line=%d -->\n\n", e.ID, p.relPath(f.Path), e.Line))
+		}
+		sb.WriteString(elementHeading(e))
+
+		if e.Internal && config.CFG.InternalSymbols == "tag" {
+			sb.WriteString("*Internal*\n\n")
+		}
+
+		if e.Brief != "" {
+			sb.WriteString(fmt.Sprintf("*%s*\n\n", e.Brief))
+		}
 
 		if e.Description != "" {
-			sb.WriteString(e.Description + "\n\n")
+			sb.WriteString(truncateDescription(formatSections(e.Description)) + "\n\n")
+		}
+
+		if len(e.Params) > 0 {
+			sb.WriteString("**Parameters:**\n\n| Name | Description |\n| --- | --- |\n")
+			for _, param := range e.Params {
+				sb.WriteString(fmt.Sprintf("| `%s` | %s |\n", param.Name, tableCell(param.Description)))
+			}
+			sb.WriteString("\n")
+		}
+
+		if e.Returns != "" {
+			sb.WriteString(fmt.Sprintf("**Returns:** %s\n\n", e.Returns))
+		}
+		if e.Language != ProseLang {
+			sig := e.Signature
+			if config.CFG.WrapSignatures {
+				sig = wrapSignature(sig)
+			}
+			sb.WriteString(fmt.Sprintf("```%s\n%s\n```\n\n", FenceLang(cmp.Or(e.Language, f.Language), "markdown"), sig))
+		}
+
+		if config.CFG.StructuredSignatures && e.FuncName != "" {
+			sb.WriteString(fmt.Sprintf("**Return type:** `%s`", e.ReturnType))
+			if e.ParamList != "" {
+				sb.WriteString(fmt.Sprintf(" | **Parameter list:** `%s`", e.ParamList))
+			}
+			sb.WriteString("\n\n")
 		}
-		sb.WriteString(fmt.Sprintf("```%s\n%s\n```\n\n", f.Language, e.Signature))
 	}
 
-	return sb.String()
+	if len(f.Related) > 0 {
+		sb.WriteString("## Related Files\n\n")
+		for _, r := range f.Related {
+			sb.WriteString(fmt.Sprintf("- [%s](%s)\n", r.Name, r.Link))
+		}
+		sb.WriteString("\n")
+	}
+
+	return finishDocument(sb.String())
+}
+
+// orders elements by their @group, groups in order of their first element and elements in
+// declaration order within them, ungrouped elements form the default_group, reports false
+// and leaves elements alone when no element has a group
+func groupElements(elements []Element) ([]Element, bool) {
+	if !slices.ContainsFunc(elements, func(e Element) bool { return e.Group != "" }) {
+		return elements, false
+	}
+
+	grouped := slices.Clone(elements)
+	for i := range grouped {
+		grouped[i].Group = cmp.Or(grouped[i].Group, config.CFG.DefaultGroup)
+	}
+
+	order := make(map[string]int)
+	for _, e := range grouped {
+		if _, ok := order[e.Group]; !ok {
+			order[e.Group] = len(order)
+		}
+	}
+	slices.SortStableFunc(grouped, func(a, b Element) int { return order[a.Group] - order[b.Group] })
+
+	return grouped, true
+}
+
+// filters out internal elements unless internal_visibility lists the output,
+// one of "page", "index" or "json"
+func visibleElements(elements []Element, output string) []Element {
+	if slices.Contains(config.CFG.InternalVisibility, output) {
+		return elements
+	}
+
+	return slices.DeleteFunc(slices.Clone(elements), func(e Element) bool { return e.Internal })
+}
+
+// returns path relative to the scan root with forward slashes, or unchanged if that fails
+func (p *Parser) relPath(path string) string {
+	if p.Root == "" {
+		return filepath.ToSlash(path)
+	}
+
+	rel, err := filepath.Rel(p.Root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// "Home / dir / subdir / file" trail for a page at doc, Home links to the project index
+func breadcrumbs(doc, name string) string {
+	dirs := strings.Split(path.Dir(doc), "/")
+	if dirs[0] == "." {
+		dirs = nil
+	}
+
+	home, index := "Home", ""
+	if config.CFG.GenerateIndex && len(config.CFG.IndexFiles) > 0 {
+		index = strings.Repeat("../", len(dirs)) + config.CFG.IndexFiles[0]
+		home = fmt.Sprintf("[Home](%s)", index)
+	}
+
+	// directories link to their first file in the files index, the namespace index has no files
+	crumbs := []string{home}
+	for i, dir := range dirs {
+		if index != "" && config.CFG.IndexStyle != "namespace" {
+			dir = fmt.Sprintf("[%s](%s#%s)", dir, index, dirAnchor(path.Join(dirs[:i+1]...)))
+		}
+		crumbs = append(crumbs, dir)
+	}
+	crumbs = append(crumbs, name)
+	return strings.Join(crumbs, " / ") + "\n\n"
+}
+
+// anchor of an output directory in the files index, the target of breadcrumb links
+func dirAnchor(dir string) string {
+	return "dir-" + Anchor(strings.ReplaceAll(dir, "/", "-"))
+}
+
+// yaml front matter with the configured fields, "title" is the file name and "date"
+// the date of the last commit, fields without a value are left out
+func frontMatter(f *File) string {
+	var fields []string
+	for _, field := range config.CFG.FrontMatter {
+		switch field {
+		case "title":
+			fields = append(fields, fmt.Sprintf("title: %q", filepath.Base(f.Path)))
+		case "date":
+			if f.GitInfo != nil && f.GitInfo.LastCommitDate != "" {
+				fields = append(fields, "date: "+f.GitInfo.LastCommitDate)
+			}
+		}
+	}
+
+	if config.CFG.SourceChecksum && f.Checksum != "" {
+		if len(fields) == 0 {
+			return fmt.Sprintf("<!-- source-sha256: %s -->\n\n", f.Checksum)
+		}
+		fields = append(fields, "source_sha256: "+f.Checksum)
+	}
+
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return "---\n" + strings.Join(fields, "\n") + "\n---\n\n"
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// trims the trailing blank lines left by the section spacing, generated documents end with
+// exactly one newline unless trailing_newline is disabled, in which case they end without one
+func finishDocument(doc string) string {
+	doc = strings.TrimRight(doc, " \t\r\n")
+	if config.CFG.TrailingNewline {
+		doc += "\n"
+	}
+
+	return doc
+}
+
+// cuts descriptions longer than max_description_lines, the rest is put into a collapsed
+// <details> block, the cut is moved past any code fence it would split
+func truncateDescription(desc string) string {
+	limit := config.CFG.MaxDescriptionLines
+	lines := strings.Split(desc, "\n")
+	if limit <= 0 || len(lines) <= limit {
+		return desc
+	}
+
+	inFence := false
+	cut := len(lines)
+	for i, line := range lines {
+		if i >= limit && !inFence {
+			cut = i
+			break
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+	}
+
+	rest := strings.TrimSpace(strings.Join(lines[cut:], "\n"))
+	if rest == "" {
+		return desc
+	}
+
+	return fmt.Sprintf("%s\n\n<details>\n<summary>Show more</summary>\n\n%s\n\n</details>",
+		strings.Join(lines[:cut], "\n"), rest)
+}
+
+// renders the configured section labels as bold subsection headers, a label is recognized
+// as 'Label:' or as a markdown heading '# Label' at the start of a line outside code fences,
+// text following 'Label:' on the same line is kept below the header
+func formatSections(desc string) string {
+	if len(config.CFG.SectionLabels) == 0 {
+		return desc
+	}
+
+	lines := strings.Split(desc, "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+
+		label, rest, ok := matchSection(trimmed)
+		if inFence || !ok {
+			out = append(out, line)
+			continue
+		}
+
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, fmt.Sprintf("**%s**", label), "")
+		if rest != "" {
+			out = append(out, rest)
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+func matchSection(line string) (label, rest string, ok bool) {
+	if strings.HasPrefix(line, "#") {
+		text := strings.TrimSpace(strings.TrimLeft(line, "#"))
+		for _, l := range config.CFG.SectionLabels {
+			if strings.EqualFold(text, l) {
+				return l, "", true
+			}
+		}
+		return "", "", false
+	}
+
+	for _, l := range config.CFG.SectionLabels {
+		if len(line) > len(l) && strings.EqualFold(line[:len(l)], l) && line[len(l)] == ':' {
+			return l, strings.TrimSpace(line[len(l)+1:]), true
+		}
+	}
+
+	return "", "", false
+}
+
+type heading struct {
+	// nesting relative to the shallowest heading found, starting at 0
+	Level int
+	Text  string
+}
+
+// collects the markdown ATX headings of a description, skipping fenced code blocks
+func findHeadings(desc string) []heading {
+	var headings []heading
+	inFence := false
+	minLevel := 0
+
+	for _, line := range strings.Split(desc, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+
+		if inFence || !strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		text := strings.TrimSpace(strings.TrimRight(trimmed[level:], "#"))
+		if level > 6 || text == "" || trimmed[level] != ' ' {
+			continue
+		}
+
+		if minLevel == 0 || level < minLevel {
+			minLevel = level
+		}
+		headings = append(headings, heading{Level: level, Text: text})
+	}
+
+	for i := range headings {
+		headings[i].Level -= minLevel
+	}
+
+	return headings
+}
+
+// the heading content depends on element_heading, when it isn't the bare ID an explicit
+// anchor is emitted so links built from the ID keep working
+func elementHeading(e Element) string {
+	switch config.CFG.ElementHeading {
+	case "signature":
+		if e.Signature != "" {
+			return fmt.Sprintf("<a id=\"%s\"></a>\n\n#### `%s`\n\n", Anchor(e.ID), e.Signature)
+		}
+	case "id_and_signature":
+		if e.Signature != "" {
+			return fmt.Sprintf("<a id=\"%s\"></a>\n\n#### %s `%s`\n\n", Anchor(e.ID), e.ID, e.Signature)
+		}
+	}
+
+	return fmt.Sprintf("#### %s\n\n", e.ID)
+}
+
+func formatStats(f *File) string {
+	size := fmt.Sprintf("%d B", f.Size)
+	if f.Size >= 1024*1024 {
+		size = fmt.Sprintf("%.1f MB", float64(f.Size)/(1024*1024))
+	} else if f.Size >= 1024 {
+		size = fmt.Sprintf("%.1f KB", float64(f.Size)/1024)
+	}
+
+	return fmt.Sprintf("%d lines of code, %s", f.LOC, size)
+}
+
+func shortHash(hash string) string {
+	if n := config.CFG.CommitHashLength; n > 0 && len(hash) > n {
+		return hash[:n]
+	}
+
+	return hash
+}
+
+// markdown for the short last commit hash of a file, linked to the provider when possible
+func (p *Parser) commitRef(f *File) string {
+	if f.GitInfo == nil || f.GitInfo.LastCommitHash == "" {
+		return ""
+	}
+
+	short := fmt.Sprintf("`%s`", shortHash(f.GitInfo.LastCommitHash))
+	if p.RepoInfo != nil {
+		if url := git.GetCommitURL(p.RepoInfo, f.GitInfo.LastCommitHash); url != "" {
+			return fmt.Sprintf("[%s](%s)", short, url)
+		}
+	}
+
+	return short
 }
 
 func (p *Parser) generateGitMetadata(f *File) string {
@@ -234,24 +1232,80 @@ func (p *Parser) generateGitMetadata(f *File) string {
 	return sb.String()
 }
 
+// stands in for the git card of files that exist on disk but were never committed
+func generateUncommittedCard() string {
+	labels := config.CFG.Git.Labels
+	return fmt.Sprintf("<div>\n\n### %s\n\n<em>%s</em>\n\n</div>\n\n", labels.Title, labels.Uncommitted)
+}
+
 func (p *Parser) generateDetailedCard(f *File) string {
 	var sb strings.Builder
 
+	labels := config.CFG.Git.Labels
+
 	sb.WriteString("<div>\n\n")
 
-	sb.WriteString("### File Information\n\n")
+	sb.WriteString(fmt.Sprintf("### %s\n\n", labels.Title))
+
+	commit := p.cardCommit(f)
+	repo := p.cardRepository(f)
+	contributors := p.cardContributors(f)
+
+	// stacked puts every section in its own block so narrow screens reflow them
+	// instead of squeezing the table columns
+	if config.CFG.GitCardLayout == "stacked" {
+		for _, section := range []string{commit, repo, contributors} {
+			if section != "" {
+				sb.WriteString("<div>\n" + section + "</div>\n")
+			}
+		}
+		sb.WriteString("\n</div>\n\n")
+		return sb.String()
+	}
 
 	sb.WriteString("<table>\n")
 	sb.WriteString("<tr>\n")
+	sb.WriteString("<td>\n" + commit + "</td>\n")
+	sb.WriteString("<td>\n" + repo + "</td>\n")
+	sb.WriteString("</tr>\n")
 
-	sb.WriteString("<td>\n")
+	if contributors != "" {
+		sb.WriteString("<tr>\n")
+		sb.WriteString("<td colspan=\"2\">\n" + contributors + "</td>\n")
+		sb.WriteString("</tr>\n")
+	}
+
+	sb.WriteString("</table>\n\n")
+	sb.WriteString("</div>\n\n")
+
+	return sb.String()
+}
+
+// collapsed list of the latest commits of a file, each hash linked to the provider when possible
+func (p *Parser) recentCommits(f *File) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<details>\n<summary>%s</summary>\n\n", config.CFG.Git.Labels.Recent))
 
-	commitShort := f.GitInfo.LastCommitHash
-	if len(commitShort) > 7 {
-		commitShort = commitShort[:7]
+	for _, c := range f.GitInfo.Recent {
+		hash := fmt.Sprintf("`%s`", shortHash(c.Hash))
+		if url := git.GetCommitURL(p.RepoInfo, c.Hash); url != "" {
+			hash = fmt.Sprintf("[%s](%s)", hash, url)
+		}
+		sb.WriteString(fmt.Sprintf("- %s %s %s\n", hash, c.Date, c.Subject))
 	}
 
-	sb.WriteString("<strong>Last Update</strong><br/>\n")
+	sb.WriteString("\n</details>\n\n")
+
+	return sb.String()
+}
+
+func (p *Parser) cardCommit(f *File) string {
+	var sb strings.Builder
+	labels := config.CFG.Git.Labels
+
+	commitShort := shortHash(f.GitInfo.LastCommitHash)
+
+	sb.WriteString(fmt.Sprintf("<strong>%s</strong><br/>\n", labels.LastUpdate))
 	commitURL := git.GetCommitURL(p.RepoInfo, f.GitInfo.LastCommitHash)
 	if commitURL != "" {
 		sb.WriteString(fmt.Sprintf(
@@ -270,12 +1324,15 @@ func (p *Parser) generateDetailedCard(f *File) string {
 		sb.WriteString(fmt.Sprintf("<em>%s</em>\n", msg))
 	}
 
-	sb.WriteString("</td>\n")
+	return sb.String()
+}
 
-	sb.WriteString("<td>\n")
+func (p *Parser) cardRepository(f *File) string {
+	var sb strings.Builder
+	labels := config.CFG.Git.Labels
 
 	if p.RepoInfo.RepoOwner != "" && p.RepoInfo.RepoName != "" {
-		sb.WriteString("<strong>Repository</strong><br/>\n")
+		sb.WriteString(fmt.Sprintf("<strong>%s</strong><br/>\n", labels.Repository))
 		relPath, _ := filepath.Rel(p.RepoInfo.GitRoot, f.Path)
 		relPath = filepath.ToSlash(relPath)
 		relPath = filepath.Clean(relPath)
@@ -284,44 +1341,64 @@ func (p *Parser) generateDetailedCard(f *File) string {
 			sb.WriteString(fmt.Sprintf(
 				"<a href=\"%s\">%s/%s</a><br/>\n",
 				fileURL, p.RepoInfo.RepoOwner, p.RepoInfo.RepoName))
+		} else {
+			sb.WriteString(fmt.Sprintf("%s/%s<br/>\n", p.RepoInfo.RepoOwner, p.RepoInfo.RepoName))
 		}
 	}
 
 	if p.RepoInfo.CurrentBranch != "" {
 		sb.WriteString(fmt.Sprintf(
-			"<strong>Branch:</strong> <code>%s</code><br/>\n",
-			p.RepoInfo.CurrentBranch))
+			"<strong>%s:</strong> <code>%s</code><br/>\n",
+			labels.Branch, p.RepoInfo.CurrentBranch))
+	}
+
+	if config.CFG.ShowFileStats {
+		sb.WriteString(fmt.Sprintf(
+			"<strong>%s:</strong> %s<br/>\n",
+			labels.Stats, formatStats(f)))
+	}
+
+	if config.CFG.GitChurn {
+		sb.WriteString(fmt.Sprintf(
+			"<strong>%s:</strong> +%d / -%d lines<br/>\n",
+			labels.Churn, f.GitInfo.Insertions, f.GitInfo.Deletions))
 	}
 
 	if f.GitInfo.TotalCommits > 0 {
 		sb.WriteString(fmt.Sprintf(
-			"<strong>History:</strong> %d commits\n",
-			f.GitInfo.TotalCommits))
+			"<strong>%s:</strong> %d commits\n",
+			labels.History, f.GitInfo.TotalCommits))
 	}
 
-	sb.WriteString("</td>\n")
-	sb.WriteString("</tr>\n")
+	return sb.String()
+}
 
-	if len(f.GitInfo.Authors) > 0 {
-		sb.WriteString("<tr>\n")
-		sb.WriteString("<td colspan=\"2\">\n")
-		sb.WriteString("<strong>Contributors</strong><br/>\n")
-		sb.WriteString("<div>\n")
+func (p *Parser) cardContributors(f *File) string {
+	if len(f.GitInfo.Authors) == 0 {
+		return ""
+	}
 
-		for _, author := range f.GitInfo.Authors {
-			avatarURL := git.GetAvatarURL(p.RepoInfo, author, config.CFG.GitAvatarSize)
-			sb.WriteString(fmt.Sprintf(
-				"<img src=\"%s\" alt=\"%s\" width=\"%d\" height=\"%d\" />\n",
-				avatarURL, author.Name, config.CFG.GitAvatarSize, config.CFG.GitAvatarSize))
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<strong>%s</strong><br/>\n", config.CFG.Git.Labels.Contributors))
+	sb.WriteString("<div>\n")
+
+	for _, author := range f.GitInfo.Authors {
+		avatarURL := git.GetAvatarURL(p.RepoInfo, author, config.CFG.GitAvatarSize)
+		if avatarURL == "" {
+			// offline, names instead of avatars
+			sb.WriteString(author.Name + "<br/>\n")
+			continue
 		}
-
-		sb.WriteString("</div>\n")
-		sb.WriteString("</td>\n")
-		sb.WriteString("</tr>\n")
+		img := fmt.Sprintf(
+			"<img src=\"%s\" alt=\"%s\" width=\"%d\" height=\"%d\" />",
+			avatarURL, author.Name, config.CFG.GitAvatarSize, config.CFG.GitAvatarSize)
+		if author.Login != "" {
+			img = fmt.Sprintf("<a href=\"https://github.com/%s\">%s</a>", author.Login, img)
+		}
+		sb.WriteString(img + "\n")
 	}
 
-	sb.WriteString("</table>\n\n")
-	sb.WriteString("</div>\n\n")
+	sb.WriteString("</div>\n")
 
 	return sb.String()
 }
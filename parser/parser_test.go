@@ -0,0 +1,1073 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/kociumba/kdoc/config"
+	"github.com/kociumba/kdoc/git"
+	"github.com/kociumba/kdoc/report"
+)
+
+// setConfig applies set to config.CFG for the duration of the test, maps and slices must be
+// replaced instead of modified in place so the restored defaults aren't affected
+func setConfig(t *testing.T, set func(c *config.Config)) {
+	t.Helper()
+	saved := config.CFG
+	t.Cleanup(func() { config.CFG = saved })
+	set(&config.CFG)
+}
+
+// parses src as a file of lang with the current config
+func parseSource(t *testing.T, path, lang, src string) *File {
+	t.Helper()
+	f := &File{Language: lang}
+	ParseContent(path, []byte(src), f, config.CFG.DocCommentFor(lang), config.CFG.IgnoreIndented)
+	return f
+}
+
+// parses src and renders its page without any project context
+func renderSource(t *testing.T, path, lang, src string) string {
+	t.Helper()
+	p := &Parser{ElementIndex: make(map[string]string)}
+	return p.GenerateMarkdownForFile(parseSource(t, path, lang, src))
+}
+
+func elementIDs(f *File) []string {
+	var ids []string
+	for _, e := range f.Elements {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestOnlyExportedClassMembers(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.OnlyExported = true })
+
+	f := parseSource(t, "widget.hpp", "cpp", `/// module
+
+class Widget {
+public:
+    /// visible
+    void draw();
+private:
+    /// hidden
+    void layout();
+public:
+    /// visible again
+    void resize();
+};
+`)
+
+	if got, want := elementIDs(f), []string{"draw", "resize"}; !slices.Equal(got, want) {
+		t.Errorf("elements = %v, want %v", got, want)
+	}
+}
+
+func TestOnlyExportedAfterClass(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.OnlyExported = true
+		c.DocCommentByLang = config.LangPrefixMap{"python": {"##"}}
+	})
+
+	py := parseSource(t, "widget.py", "python", `## module
+
+class Widget:
+    ## draws the widget
+    def draw(self):
+        pass
+
+## module level helper
+def draw(widget):
+    pass
+`)
+	if got := len(py.Elements); got != 2 {
+		t.Errorf("python elements = %v, want the method and the module level function", elementIDs(py))
+	}
+
+	ts := parseSource(t, "widget.ts", "typescript", `/// module
+
+export class Widget {
+    /// draws the widget
+    draw(): void {}
+}
+
+/// renders every widget
+export function render(): void {}
+`)
+	if got, want := elementIDs(ts), []string{"draw", "render"}; !slices.Equal(got, want) {
+		t.Errorf("typescript elements = %v, want %v", got, want)
+	}
+}
+
+func TestOnlyExportedGoNames(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.OnlyExported = true })
+
+	f := parseSource(t, "x.go", "go", `// module
+
+/// exported type
+type Exported struct{}
+
+/// unexported type
+type internal struct{}
+
+/// exported method
+func (e *Exported) Do() {}
+
+/// unexported method
+func (e *Exported) do() {}
+
+/// exported func
+func Public() {}
+
+/// unexported func
+func private() {}
+`)
+
+	var docs []string
+	for _, e := range f.Elements {
+		docs = append(docs, e.Description)
+	}
+	if want := []string{"exported type", "exported method", "exported func"}; !slices.Equal(docs, want) {
+		t.Errorf("elements = %v, want %v", docs, want)
+	}
+}
+
+func TestMultipleDocPrefixes(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.DocComment = config.StringList{"//", "///"} })
+
+	f := parseSource(t, "x.c", "c", `// module
+
+/// draws a widget
+void draw(int x);
+
+// clears a widget
+void clear(void);
+`)
+
+	if f.ModuleDesc != "module" {
+		t.Errorf("module = %q, want %q", f.ModuleDesc, "module")
+	}
+	var docs []string
+	for _, e := range f.Elements {
+		docs = append(docs, e.Description)
+	}
+	// "//" is listed first but "///" is longer, so no "/" is left over
+	if want := []string{"draws a widget", "clears a widget"}; !slices.Equal(docs, want) {
+		t.Errorf("descriptions = %q, want %q", docs, want)
+	}
+}
+
+func TestLineCommentFollowedByBlockComment(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.BlockCommentStart = "/**"
+		c.BlockCommentEnd = "*/"
+	})
+
+	f := parseSource(t, "x.c", "c", `/// module
+
+/// first
+/** second */
+void foo(int x);
+`)
+
+	if len(f.Elements) != 2 {
+		t.Fatalf("got %d elements %v, want 2", len(f.Elements), elementIDs(f))
+	}
+	if e := f.Elements[0]; e.Description != "first" || e.Signature != "" {
+		t.Errorf("first element = %q with signature %q, want a standalone comment", e.Description, e.Signature)
+	}
+	if e := f.Elements[1]; e.ID != "foo" || e.Description != "second" {
+		t.Errorf("second element = %q %q, want foo documented by the block comment", e.ID, e.Description)
+	}
+}
+
+func TestBlockCommentsDisabledByDefault(t *testing.T) {
+	f := parseSource(t, "x.c", "c", `/// module
+
+/** not a doc comment */
+void foo(int x);
+`)
+
+	if len(f.Elements) != 0 {
+		t.Errorf("got elements %v, want none with block comments disabled", elementIDs(f))
+	}
+}
+
+func TestGroupTag(t *testing.T) {
+	md := renderSource(t, "x.c", "c", `/// module
+
+/// first init
+/// @group Init
+void init_a(void);
+
+/// ungrouped
+void draw(void);
+
+/// second init
+/// @group Init
+void init_b(void);
+`)
+
+	initAt := strings.Index(md, "### Init")
+	otherAt := strings.Index(md, "### "+config.CFG.DefaultGroup)
+	if initAt == -1 || otherAt == -1 {
+		t.Fatalf("missing group headings:\n%s", md)
+	}
+
+	a, b, draw := strings.Index(md, "#### init_a"), strings.Index(md, "#### init_b"), strings.Index(md, "#### draw")
+	if !(initAt < a && a < b && b < otherAt && otherAt < draw) {
+		t.Errorf("init_a and init_b should be under Init in declaration order, draw under %s:\n%s", config.CFG.DefaultGroup, md)
+	}
+}
+
+// replaces the source reader, fail returns the error of the n-th read or nil to read the file
+func failReads(t *testing.T, fail func(n int) error) {
+	t.Helper()
+	saved := readFile
+	t.Cleanup(func() { readFile = saved })
+
+	n := 0
+	readFile = func(path string) ([]byte, error) {
+		n++
+		if err := fail(n); err != nil {
+			return nil, err
+		}
+		return saved(path)
+	}
+}
+
+func TestReadSourceRetries(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.ReadRetries = 2 })
+	failReads(t, func(n int) error {
+		if n == 1 {
+			return syscall.ESTALE
+		}
+		return nil
+	})
+
+	path := filepath.Join(t.TempDir(), "x.c")
+	if err := os.WriteFile(path, []byte("/// module\n\n/// doc\nvoid foo(void);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &File{Language: "c"}
+	if err := ParseFile(path, f, config.CFG.DocComment, false); err != nil {
+		t.Fatalf("ParseFile after a transient failure: %v", err)
+	}
+	if got := elementIDs(f); !slices.Equal(got, []string{"foo"}) {
+		t.Errorf("elements = %v, want [foo]", got)
+	}
+}
+
+func TestReadSourceGivesUp(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.ReadRetries = 1 })
+	reads := 0
+	failReads(t, func(n int) error {
+		reads = n
+		return syscall.ESTALE
+	})
+
+	_, err := ReadSource(filepath.Join(t.TempDir(), "x.c"))
+	if !errors.Is(err, ErrReadFailed) || !errors.Is(err, syscall.ESTALE) {
+		t.Errorf("err = %v, want a ReadError wrapping ESTALE", err)
+	}
+	if reads != 2 {
+		t.Errorf("read %d times, want the first attempt and 1 retry", reads)
+	}
+}
+
+func TestExtractIDFromSig(t *testing.T) {
+	for sig, want := range map[string]string{
+		"class Widget : public Base {":          "Widget",
+		"struct point {":                        "point",
+		"int foo(double x);":                    "foo",
+		"static void bar(void)":                 "bar",
+		"std::vector<int> make_list(int n)":     "make_list",
+		"template <typename T> T max(T a, T b)": "max",
+		"typedef int my_int;":                   "typedef",
+		"":                                      "",
+	} {
+		if got := extractIDFromSig(sig); got != want {
+			t.Errorf("extractIDFromSig(%q) = %q, want %q", sig, got, want)
+		}
+	}
+}
+
+func TestProcessBacklinks(t *testing.T) {
+	index := map[string]string{"foo": "a.md#foo", "bar": "sub/b.md#bar"}
+	for _, tc := range []struct{ desc, from, want string }{
+		{"see [foo] and [bar]", "sub/c.md", "see [foo](../a.md#foo) and [bar](b.md#bar)"},
+		{"not [text](url) or [missing]", "a.md", "not [text](url) or [missing]"},
+		{"see @ref foo", "a.md", "see [foo](a.md#foo)"},
+	} {
+		if got := ProcessBacklinks(tc.desc, index, tc.from); got != tc.want {
+			t.Errorf("ProcessBacklinks(%q) = %q, want %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestBacklinksKeepInlineLinks(t *testing.T) {
+	index := map[string]string{"Widget": "gfx/widget.md#widget", "draw": "gfx/draw.md#draw"}
+
+	desc := "wraps a [Widget](https://example.com/widget) for [draw] and [Widget]"
+	want := "wraps a [Widget](https://example.com/widget) for [draw](draw.md#draw) and [Widget](widget.md#widget)"
+	if got := ProcessBacklinks(desc, index, "gfx/list.md"); got != want {
+		t.Errorf("ProcessBacklinks = %q, want %q", got, want)
+	}
+}
+
+func TestDoxygenRefs(t *testing.T) {
+	index := map[string]string{"Foo": "gfx/foo.md#foo", "Bar": "gfx/bar.md#bar"}
+	for _, tc := range []struct{ desc, want string }{
+		{"see @ref Foo.", "see [Foo](foo.md#foo)."},
+		{"see @ref Foo \"the foo\"", "see [the foo](foo.md#foo)"},
+		{"uses @link Bar the bar @endlink internally", "uses [the bar](bar.md#bar) internally"},
+	} {
+		if got := ProcessBacklinks(tc.desc, index, "gfx/page.md"); got != tc.want {
+			t.Errorf("ProcessBacklinks(%q) = %q, want %q", tc.desc, got, tc.want)
+		}
+	}
+
+	report.Reset()
+	t.Cleanup(report.Reset)
+	if got := ProcessBacklinks("see @ref Missing", index, "a.md"); got != "see Missing" {
+		t.Errorf("unresolved @ref = %q, want its text", got)
+	}
+	if report.Count() != 1 {
+		t.Errorf("%d warnings, want the unresolved reference reported", report.Count())
+	}
+}
+
+var benchSource = func() string {
+	var sb strings.Builder
+	sb.WriteString("/// module, see [widget_draw]\n\n")
+	for i := range 200 {
+		sb.WriteString("/// draws the widget, see [widget_layout]\n")
+		sb.WriteString("int widget_draw" + strconv.Itoa(i) + "(struct widget *w, double scale) {\n}\n\n")
+	}
+	return sb.String()
+}()
+
+func BenchmarkParseContent(b *testing.B) {
+	data := []byte(benchSource)
+	for b.Loop() {
+		ParseContent("bench.c", data, &File{Language: "c"}, []string{"///"}, false)
+	}
+}
+
+// compares the hoisted funcRe with compiling it on every call like extractIDFromSig used to
+func BenchmarkExtractIDFromSig(b *testing.B) {
+	const sig = "int widget_draw(struct widget *w, double scale)"
+	b.Run("precompiled", func(b *testing.B) {
+		for b.Loop() {
+			extractIDFromSig(sig)
+		}
+	})
+	b.Run("compile_per_call", func(b *testing.B) {
+		for b.Loop() {
+			regexp.MustCompile(funcRe.String()).FindStringSubmatch(sig)
+		}
+	})
+}
+
+func BenchmarkProcessBacklinks(b *testing.B) {
+	index := map[string]string{"foo": "a.md#foo", "bar": "sub/b.md#bar"}
+	for b.Loop() {
+		ProcessBacklinks("see [foo] and [bar] or @ref foo", index, "sub/c.md")
+	}
+}
+
+func TestAlternatingCommentStyles(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.BlockCommentStart = "/**"
+		c.BlockCommentEnd = "*/"
+	})
+
+	f := parseSource(t, "x.c", "c", `/// module
+
+/// line one
+void one(void);
+
+/**
+ * block two
+ */
+void two(void);
+
+/// line three
+void three(void);
+
+/** block four */
+void four(void);
+`)
+
+	if got, want := elementIDs(f), []string{"one", "two", "three", "four"}; !slices.Equal(got, want) {
+		t.Errorf("elements = %v, want %v", got, want)
+	}
+	if d := f.Elements[1].Description; d != "block two" {
+		t.Errorf("two = %q, want the block comment without decoration", d)
+	}
+}
+
+// a file of a github repository with two commits by two authors
+func committedFile() File {
+	return File{
+		Path:       "a.c",
+		Language:   "c",
+		ModuleDesc: "module",
+		LOC:        3,
+		Size:       42,
+		GitInfo: &git.FileInfo{
+			LastCommitHash:    testHash,
+			LastCommitDate:    "2024-05-01",
+			LastCommitMessage: "fix the widget",
+			LastAuthorName:    "Jane Doe",
+			LastAuthorEmail:   "jane@example.com",
+			Authors: []git.Author{
+				{Name: "Jane Doe", Email: "jane@example.com"},
+				{Name: "John Roe", Email: "john@example.com"},
+			},
+			TotalCommits: 2,
+		},
+	}
+}
+
+func TestGitCardLabels(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.Git.Labels.Title = "Dateiinformationen"
+		c.Git.Labels.LastUpdate = "Letzte Änderung"
+		c.Git.Labels.Contributors = "Mitwirkende"
+	})
+
+	p := githubParser(committedFile())
+	page := p.GenerateMarkdownForFile(&p.Files[0])
+	for _, label := range []string{"Dateiinformationen", "Letzte Änderung", "Mitwirkende"} {
+		if !strings.Contains(page, label) {
+			t.Errorf("card misses the label %q:\n%s", label, page)
+		}
+	}
+	if strings.Contains(page, "File Information") {
+		t.Errorf("card still uses the default title:\n%s", page)
+	}
+}
+
+func TestPythonSignatureTrim(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.DocComment = config.StringList{"##"} })
+
+	f := parseSource(t, "x.py", "python", `## module
+
+## greets
+def foo():
+    pass
+`)
+
+	if len(f.Elements) != 1 || f.Elements[0].Signature != "def foo()" {
+		t.Fatalf("elements = %+v, want def foo() without the colon", f.Elements)
+	}
+	if f.Elements[0].ID != "foo" {
+		t.Errorf("ID = %q, want foo", f.Elements[0].ID)
+	}
+}
+
+func TestMinCommitsForCard(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.MinCommitsForCard = 2 })
+
+	single := committedFile()
+	single.GitInfo.TotalCommits = 1
+	p := githubParser(single, committedFile())
+
+	if page := p.GenerateMarkdownForFile(&p.Files[0]); strings.Contains(page, config.CFG.Git.Labels.Title) {
+		t.Errorf("single commit file has a card at threshold 2:\n%s", page)
+	}
+	if page := p.GenerateMarkdownForFile(&p.Files[1]); !strings.Contains(page, config.CFG.Git.Labels.Title) {
+		t.Errorf("file with 2 commits has no card:\n%s", page)
+	}
+}
+
+func TestModuleHeading(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.ModuleHeading = "Overview" })
+
+	md := renderSource(t, "x.c", "c", "/// draws widgets\n")
+	if !strings.Contains(md, "## Overview\n\ndraws widgets\n") {
+		t.Errorf("module description isn't under the Overview heading:\n%s", md)
+	}
+}
+
+func TestFileStats(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.ShowFileStats = true })
+
+	// 4 non blank lines padded to 1100 bytes by the last one
+	head := "/// module\n\n/// doc\nvoid foo(void);\n\n"
+	src := head + "// " + strings.Repeat("x", 1100-len(head)-4) + "\n"
+
+	f := parseSource(t, "x.c", "c", src)
+	if f.LOC != 4 || f.Size != 1100 {
+		t.Errorf("LOC = %d, Size = %d, want 4 and 1100", f.LOC, f.Size)
+	}
+
+	p := &Parser{ElementIndex: make(map[string]string)}
+	if md := p.GenerateMarkdownForFile(f); !strings.Contains(md, "*4 lines of code, 1.1 KB*") {
+		t.Errorf("page misses the stats:\n%s", md)
+	}
+
+	committed := committedFile()
+	committed.LOC, committed.Size = f.LOC, f.Size
+	p = githubParser(committed)
+	if md := p.GenerateMarkdownForFile(&p.Files[0]); !strings.Contains(md, config.CFG.Git.Labels.Stats+":</strong> 4 lines of code, 1.1 KB") {
+		t.Errorf("card misses the stats:\n%s", md)
+	}
+}
+
+func TestEmptyPlaceholder(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.EmptyPlaceholder = "*No documentation available.*" })
+
+	if md := renderSource(t, "x.c", "c", "int x;\n"); !strings.Contains(md, "*No documentation available.*") {
+		t.Errorf("undocumented page has no placeholder:\n%s", md)
+	}
+	if md := renderSource(t, "x.c", "c", "/// documented\n"); strings.Contains(md, "No documentation") {
+		t.Errorf("documented page has the placeholder:\n%s", md)
+	}
+}
+
+func TestAuthorTags(t *testing.T) {
+	md := renderSource(t, "x.c", "c", `/// widget drawing
+/// @author Jane Doe
+/// @author John Roe, Ann Poe
+/// @maintainer Max Moe
+`)
+
+	if !strings.Contains(md, "**Authors:** Jane Doe, John Roe, Ann Poe\n") {
+		t.Errorf("missing the authors line:\n%s", md)
+	}
+	if !strings.Contains(md, "**Maintainers:** Max Moe\n") {
+		t.Errorf("missing the maintainers line:\n%s", md)
+	}
+	if strings.Contains(md, "@author") {
+		t.Errorf("the tags are left in the description:\n%s", md)
+	}
+}
+
+func TestUnnamedIDPrefix(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.UnnamedIDPrefix = "anon_" })
+
+	f := parseSource(t, "x.c", "c", `/// module
+
+/// first
+{
+
+/// second
+void named(void);
+
+/// third, at the end of the file
+`)
+
+	if got, want := elementIDs(f), []string{"anon_0", "named", "anon_2"}; !slices.Equal(got, want) {
+		t.Errorf("elements = %v, want %v", got, want)
+	}
+}
+
+func TestElementHeading(t *testing.T) {
+	const src = "/// module\n\n/// draws\nvoid Draw_Widget(int x);\n"
+	for mode, heading := range map[string]string{
+		"id":               "#### Draw_Widget\n",
+		"signature":        "<a id=\"draw_widget\"></a>\n\n#### `void Draw_Widget(int x)`\n",
+		"id_and_signature": "<a id=\"draw_widget\"></a>\n\n#### Draw_Widget `void Draw_Widget(int x)`\n",
+	} {
+		t.Run(mode, func(t *testing.T) {
+			setConfig(t, func(c *config.Config) { c.ElementHeading = mode })
+
+			md := renderSource(t, "x.c", "c", src)
+			if !strings.Contains(md, heading) {
+				t.Errorf("want heading %q in:\n%s", heading, md)
+			}
+			// the toc links the ID based anchor in every mode
+			if !strings.Contains(md, "](#draw_widget)") {
+				t.Errorf("toc doesn't link #draw_widget:\n%s", md)
+			}
+		})
+	}
+}
+
+func TestModuleHeadingsInTOC(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.TOCModuleHeadings = true })
+
+	md := renderSource(t, "x.c", "c", `/// widget drawing
+///
+/// ## Usage
+///
+/// call draw
+///
+/// ## Frequently Asked Questions
+`)
+
+	for _, entry := range []string{"\n- [Usage](#usage)\n", "\n- [Frequently Asked Questions](#frequently-asked-questions)\n"} {
+		if !strings.Contains(md, entry) {
+			t.Errorf("toc misses %q:\n%s", entry, md)
+		}
+	}
+}
+
+func TestDescriptionTruncation(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.MaxDescriptionLines = 2 })
+
+	md := renderSource(t, "x.c", "c", `/// module
+
+/// line one
+/// line two
+/// line three
+/// line four
+void foo(void);
+
+/// short
+void bar(void);
+`)
+
+	if !strings.Contains(md, "line one\nline two\n\n<details>") || !strings.Contains(md, "line four\n\n</details>") {
+		t.Errorf("long description isn't collapsed after 2 lines:\n%s", md)
+	}
+	if strings.Count(md, "<details>") != 1 {
+		t.Errorf("short description was collapsed too:\n%s", md)
+	}
+	if !strings.Contains(md, "#### foo\n") {
+		t.Errorf("heading changed:\n%s", md)
+	}
+}
+
+func TestSectionLabels(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.SectionLabels = []string{"Returns", "Parameters"} })
+
+	md := renderSource(t, "x.c", "c", `/// module
+
+/// computes things
+/// Returns: the sum
+/// # Parameters
+/// a and b
+int sum(int a, int b);
+`)
+
+	if !strings.Contains(md, "**Returns**\n\nthe sum\n") {
+		t.Errorf("Returns: isn't rendered as a bold section:\n%s", md)
+	}
+	if !strings.Contains(md, "**Parameters**\n\na and b\n") || strings.Contains(md, "# Parameters") {
+		t.Errorf("# Parameters isn't rendered as a bold section:\n%s", md)
+	}
+}
+
+func TestExternalRefs(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.ExternalRefs = map[string]string{
+			"std::vector": "https://en.cppreference.com/w/cpp/container/vector",
+			"widget":      "https://example.com/widget",
+		}
+	})
+
+	index := map[string]string{"widget": "gfx/widget.md#widget"}
+	got := ProcessBacklinks("stores [widget] in a [std::vector]", index, "gfx/list.md")
+	want := "stores [widget](widget.md#widget) in a [std::vector](https://en.cppreference.com/w/cpp/container/vector)"
+	if got != want {
+		t.Errorf("ProcessBacklinks = %q, want %q", got, want)
+	}
+}
+
+func TestStackedGitCard(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.GitCardLayout = "stacked" })
+
+	p := githubParser(committedFile())
+	md := p.GenerateMarkdownForFile(&p.Files[0])
+	if !strings.Contains(md, config.CFG.Git.Labels.Title) || !strings.Contains(md, "Jane Doe") {
+		t.Fatalf("page has no card:\n%s", md)
+	}
+	for _, tag := range []string{"<table", "<tr", "<td"} {
+		if strings.Contains(md, tag) {
+			t.Errorf("stacked card contains %s:\n%s", tag, md)
+		}
+	}
+}
+
+func TestUnicodeAnchor(t *testing.T) {
+	if got := Anchor("Größe Δx::λ"); got != "größe-δxλ" {
+		t.Errorf("Anchor = %q, want %q", got, "größe-δxλ")
+	}
+
+	md := renderSource(t, "x.cpp", "cpp", "/// module\n\n/// computes λ\ndouble Größe_λ(double x);\n")
+	anchor := Anchor("Größe_λ")
+	if !strings.Contains(md, "#### Größe_λ\n") {
+		t.Errorf("no heading for Größe_λ:\n%s", md)
+	}
+	if !strings.Contains(md, "](#"+anchor+")") || anchor != "größe_λ" {
+		t.Errorf("toc doesn't link #größe_λ:\n%s", md)
+	}
+}
+
+func TestElementMarkers(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.ElementMarkers = true })
+
+	md := renderSource(t, "src/x.h", "cpp", `/// module
+
+/// draws
+void draw(int x);
+
+/// clears
+void clear(void);
+`)
+
+	for _, marker := range []string{
+		"<!-- kdoc:element id=draw file=src/x.h line=3 -->\n\n#### draw\n",
+		"<!-- kdoc:element id=clear file=src/x.h line=6 -->\n\n#### clear\n",
+	} {
+		if !strings.Contains(md, marker) {
+			t.Errorf("want %q in:\n%s", marker, md)
+		}
+	}
+}
+
+func TestBriefTag(t *testing.T) {
+	md := renderSource(t, "x.c", "c", `/// module
+
+/// @brief draws a widget
+/// clips to the parent and flushes the frame
+void draw(int x);
+`)
+
+	toc, body, _ := strings.Cut(md, "#### draw\n")
+	if !strings.Contains(toc, "](#draw) - draws a widget\n") {
+		t.Errorf("toc entry misses the brief:\n%s", toc)
+	}
+	if strings.Contains(toc, "clips to the parent") {
+		t.Errorf("the detailed description leaked into the toc:\n%s", toc)
+	}
+	if !strings.Contains(body, "*draws a widget*\n\nclips to the parent and flushes the frame") {
+		t.Errorf("body misses the brief and the details:\n%s", body)
+	}
+	if strings.Contains(body, "@brief") {
+		t.Errorf("the tag wasn't stripped:\n%s", body)
+	}
+}
+
+func TestLangTag(t *testing.T) {
+	md := renderSource(t, "x.h", "cpp", `/// module
+
+/// c compatible entry point
+/// @lang c
+void init(void);
+
+/// c++ only overload
+void draw(Widget& w);
+`)
+
+	if !strings.Contains(md, "```c\nvoid init(void)\n```") {
+		t.Errorf("@lang c element isn't fenced as c:\n%s", md)
+	}
+	if !strings.Contains(md, "```cpp\nvoid draw(Widget& w)\n```") {
+		t.Errorf("other elements don't use the file language:\n%s", md)
+	}
+	if strings.Contains(md, "@lang") {
+		t.Errorf("the tag wasn't stripped:\n%s", md)
+	}
+}
+
+func TestFrontMatterDateWithoutCard(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.GitCard = false
+		c.FrontMatter = []string{"date"}
+	})
+
+	p := githubParser(committedFile())
+	page := p.GenerateMarkdownForFile(&p.Files[0])
+	if !strings.HasPrefix(page, "---\ndate: 2024-05-01\n---\n") {
+		t.Errorf("front matter misses the commit date:\n%s", page)
+	}
+	if strings.Contains(page, "File Information") || strings.Contains(page, testHash[:7]) {
+		t.Errorf("the git card was rendered with git_card = false:\n%s", page)
+	}
+}
+
+func TestRegexDocPrefix(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.DocComment = config.StringList{`#'\s?(.*)`}
+		c.DocCommentIsRegex = true
+		c.DocCommentByLang = nil
+	})
+
+	f := parseSource(t, "stats.R", "r", `#' summary statistics
+
+#' Computes the weighted mean
+#'
+#' @param x numeric vector
+weighted <- function(x, w) {
+  # a plain comment
+  sum(x * w) / sum(w)
+}
+`)
+
+	if f.ModuleDesc != "summary statistics" {
+		t.Errorf("module = %q, want %q", f.ModuleDesc, "summary statistics")
+	}
+	if len(f.Elements) != 1 {
+		t.Fatalf("elements = %v, want only the weighted function", elementIDs(f))
+	}
+	e := f.Elements[0]
+	if !strings.HasPrefix(e.Description, "Computes the weighted mean") || e.Signature != "weighted <- function(x, w)" {
+		t.Errorf("element = %q %q, want weighted documented as the weighted mean", e.Signature, e.Description)
+	}
+	if strings.Contains(e.Description, "#'") {
+		t.Errorf("the prefix wasn't stripped: %q", e.Description)
+	}
+}
+
+func TestStrictColumnZero(t *testing.T) {
+	const src = `/// module
+
+/// top level
+void draw(int x);
+
+struct widget {
+    /// indented member
+    int width;
+};
+`
+	if ids := elementIDs(parseSource(t, "x.c", "c", src)); len(ids) != 2 {
+		t.Fatalf("elements = %v, the indented member should be documented by default", ids)
+	}
+
+	setConfig(t, func(c *config.Config) {
+		c.StrictColumnZero = true
+		c.IgnoreIndented = false
+	})
+	f := parseSource(t, "x.c", "c", src)
+	if ids := elementIDs(f); !slices.Equal(ids, []string{"draw"}) {
+		t.Errorf("elements = %v, want only draw with strict_column_zero", ids)
+	}
+	if f.ModuleDesc != "module" {
+		t.Errorf("module = %q, want %q", f.ModuleDesc, "module")
+	}
+
+	if f := parseSource(t, "y.c", "c", "  /// indented module\n\n/// draws\nvoid draw(int x);\n"); f.ModuleDesc != "" {
+		t.Errorf("an indented module comment was used: %q", f.ModuleDesc)
+	}
+}
+
+func TestInternalSymbols(t *testing.T) {
+	const src = `/// module
+
+/// public api
+void draw(int x);
+
+/// file local helper
+static int clamp(int x);
+
+namespace {
+/// anonymous namespace helper
+int scale(int x);
+}
+`
+	for _, mode := range []string{"show", "tag", "skip"} {
+		t.Run(mode, func(t *testing.T) {
+			setConfig(t, func(c *config.Config) { c.InternalSymbols = mode })
+
+			f := parseSource(t, "x.cpp", "cpp", src)
+			want := []string{"draw", "clamp", "scale"}
+			if mode == "skip" {
+				want = []string{"draw"}
+			}
+			if ids := elementIDs(f); !slices.Equal(ids, want) {
+				t.Fatalf("elements = %v, want %v", ids, want)
+			}
+
+			md := renderSource(t, "x.cpp", "cpp", src)
+			if got, want := strings.Count(md, "*Internal*"), map[string]int{"show": 0, "tag": 2, "skip": 0}[mode]; got != want {
+				t.Errorf("%d elements tagged internal, want %d:\n%s", got, want, md)
+			}
+			if mode == "tag" && strings.Contains(md, "#### draw\n\n*Internal*") {
+				t.Errorf("the public function was tagged internal:\n%s", md)
+			}
+		})
+	}
+}
+
+func TestMaxGapLines(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.MaxGapLines = 1 })
+
+	f := parseSource(t, "x.c", "c", `/// module
+
+/// close enough
+
+void draw(int x);
+
+/// section notes, not about clear
+
+
+
+void clear(void);
+`)
+
+	if len(f.Elements) != 2 {
+		t.Fatalf("elements = %v, want 2", elementIDs(f))
+	}
+	if f.Elements[0].Signature != "void draw(int x)" {
+		t.Errorf("signature = %q, the comment one blank line away lost its declaration", f.Elements[0].Signature)
+	}
+	if e := f.Elements[1]; e.Signature != "" || e.SignatureLine != 0 {
+		t.Errorf("signature = %q on line %d, the comment three blank lines away should stand alone", e.Signature, e.SignatureLine)
+	}
+}
+
+func TestSourceChecksum(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.SourceChecksum = true })
+
+	const src = "/// module\n\n/// draws\nvoid draw(int x);\n"
+	sum := sha256.Sum256([]byte(src))
+	want := hex.EncodeToString(sum[:])
+
+	if md := renderSource(t, "x.c", "c", src); !strings.HasPrefix(md, "<!-- source-sha256: "+want+" -->\n") {
+		t.Errorf("want the sha256 of the source in a comment:\n%s", md)
+	}
+
+	setConfig(t, func(c *config.Config) { c.FrontMatter = []string{"title"} })
+	if md := renderSource(t, "x.c", "c", src); !strings.HasPrefix(md, "---\ntitle: \"x.c\"\nsource_sha256: "+want+"\n---\n") {
+		t.Errorf("want the sha256 of the source in the front matter:\n%s", md)
+	}
+}
+
+func TestIndentThreshold(t *testing.T) {
+	setConfig(t, func(c *config.Config) {
+		c.IgnoreIndented = true
+		c.IndentThreshold = 4
+	})
+
+	f := parseSource(t, "x.cpp", "cpp", `/// module
+
+namespace gfx {
+  /// one level deep
+  void draw(int x);
+
+  struct widget {
+        /// deeply nested
+        int width;
+  };
+}
+`)
+	if ids := elementIDs(f); !slices.Equal(ids, []string{"draw"}) {
+		t.Errorf("elements = %v, want only draw, the 8 space comment is past the threshold", ids)
+	}
+}
+
+func TestElementSeparator(t *testing.T) {
+	const src = "/// module\n\n/// draws\nvoid draw(int x);\n\n/// clears\nvoid clear(void);\n"
+
+	if md := renderSource(t, "x.c", "c", src); strings.Contains(md, "\n---\n") {
+		t.Errorf("a separator was rendered by default:\n%s", md)
+	}
+
+	setConfig(t, func(c *config.Config) { c.ElementSeparator = "---" })
+	md := renderSource(t, "x.c", "c", src)
+	if !strings.Contains(md, "```\n\n---\n\n#### clear\n") {
+		t.Errorf("no --- between the elements:\n%s", md)
+	}
+	if n := strings.Count(md, "\n---\n"); n != 1 {
+		t.Errorf("%d separators, want 1 between the two elements:\n%s", n, md)
+	}
+}
+
+func TestProseAndSQLElements(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.DocCommentByLang = map[string]config.StringList{"sh": {"##"}} })
+
+	const src = `## database migrations
+
+## @lang none
+## @name Overview
+## runs every pending migration in order
+set -e
+
+## @lang sql
+## creates the users table
+CREATE TABLE users (id INTEGER PRIMARY KEY);
+
+## applies one file
+apply() {
+`
+
+	f := parseSource(t, "migrate.sh", "sh", src)
+	if got, want := elementIDs(f), []string{"Overview", "users", "apply"}; !slices.Equal(got, want) {
+		t.Fatalf("elements = %v, want %v", got, want)
+	}
+	if e := f.Elements[0]; e.Signature != "" || e.SignatureLine != 0 {
+		t.Errorf("the prose-only element took %q on line %d as its signature", e.Signature, e.SignatureLine)
+	}
+
+	md := renderSource(t, "migrate.sh", "sh", src)
+	if !strings.Contains(md, "\n- [Overview](#overview)\n") {
+		t.Errorf("the toc entry of the prose-only element isn't its plain ID:\n%s", md)
+	}
+	if strings.Contains(md, "set -e") {
+		t.Errorf("the line after the prose-only element was rendered:\n%s", md)
+	}
+
+	overview, rest, _ := strings.Cut(md, "#### users")
+	if strings.Contains(overview[strings.Index(overview, "#### Overview"):], "```") {
+		t.Errorf("the prose-only element has a fence:\n%s", md)
+	}
+	if !strings.Contains(rest, "```sql\nCREATE TABLE users (id INTEGER PRIMARY KEY);\n```") {
+		t.Errorf("the sql element isn't fenced as sql:\n%s", md)
+	}
+	if !strings.Contains(rest, "```sh\napply()\n```") {
+		t.Errorf("the other element doesn't use the file language:\n%s", md)
+	}
+}
+
+func TestCRLFSource(t *testing.T) {
+	src := strings.ReplaceAll(`/// widget module
+
+/// draws a widget
+/// over two lines
+void draw(int x) {
+}
+
+/// @param w the widget
+/// @return its width
+int width(const Widget& w);
+`, "\n", "\r\n")
+
+	f := parseSource(t, "x.c", "c", src)
+	if f.ModuleDesc != "widget module" {
+		t.Errorf("module = %q, want %q", f.ModuleDesc, "widget module")
+	}
+	if len(f.Elements) != 2 {
+		t.Fatalf("elements = %v, want draw and width", elementIDs(f))
+	}
+	if e := f.Elements[0]; e.Signature != "void draw(int x)" || e.Description != "draws a widget\nover two lines" {
+		t.Errorf("draw = %q %q, want the signature trimmed at { and a clean description", e.Signature, e.Description)
+	}
+	if e := f.Elements[1]; e.Returns != "its width" || len(e.Params) != 1 || e.Params[0].Description != "the widget" {
+		t.Errorf("width tags = %q %+v, want them without \\r", e.Returns, e.Params)
+	}
+
+	if md := renderSource(t, "x.c", "c", src); strings.Contains(md, "\r") {
+		t.Errorf("the page contains a \\r:\n%q", md)
+	}
+}
+
+func TestUTF8BOM(t *testing.T) {
+	const src = "/// widget module\n\n/// draws a widget\nvoid draw(int x);\n"
+
+	plain := parseSource(t, "x.c", "c", src)
+	f := parseSource(t, "x.c", "c", "\uFEFF"+src)
+	if f.ModuleDesc != "widget module" || plain.ModuleDesc != f.ModuleDesc {
+		t.Errorf("module = %q, want %q", f.ModuleDesc, "widget module")
+	}
+	if len(f.Elements) != 1 {
+		t.Fatalf("elements = %v, want draw", elementIDs(f))
+	}
+	if e := f.Elements[0]; e.ID != "draw" || e.Description != "draws a widget" || e.Signature != "void draw(int x)" || e.Line != 3 {
+		t.Errorf("draw = %+v, want it parsed like the file without a BOM", e)
+	}
+}
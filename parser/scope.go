@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	namespaceRe = regexp.MustCompile(`^(?:inline\s+)?namespace\b\s*([\w:]*)`)
+	externCRe   = regexp.MustCompile(`^extern\s+"C(?:\+\+)?"`)
+	scopeTypeRe = regexp.MustCompile(`^(?:typedef\s+)?(?:class|struct|union|enum)\b`)
+	staticRe    = regexp.MustCompile(`\bstatic\b`)
+)
+
+// scope kinds pushed for every opened brace
+const (
+	scopeAnon  = "anon"
+	scopeNS    = "namespace"
+	scopeType  = "type"
+	scopeBlock = "block"
+)
+
+// scopeTracker is a best effort brace tracker for c/c++, it knows whether a line sits in an
+// anonymous namespace, a type body or a function body
+type scopeTracker struct {
+	scopes []string
+	// namespace names of the scopes, empty for anything but named namespaces
+	names []string
+	// kind and name of the next brace when a namespace or type head is split from its brace
+	pending     string
+	pendingName string
+}
+
+func (t *scopeTracker) track(line string) {
+	line = strings.TrimSpace(line)
+	kind, name := scopeBlock, ""
+	switch {
+	case namespaceRe.MatchString(line):
+		kind = scopeNS
+		name = namespaceRe.FindStringSubmatch(line)[1]
+		if name == "" {
+			kind = scopeAnon
+		}
+	case externCRe.MatchString(line):
+		kind = scopeNS
+	case scopeTypeRe.MatchString(line):
+		kind = scopeType
+	case t.pending != "":
+		kind, name = t.pending, t.pendingName
+	}
+
+	opened := false
+	for _, r := range line {
+		switch r {
+		case '{':
+			if opened {
+				t.push(scopeBlock, "")
+			} else {
+				t.push(kind, name)
+				opened = true
+			}
+		case '}':
+			if len(t.scopes) > 0 {
+				t.scopes = t.scopes[:len(t.scopes)-1]
+				t.names = t.names[:len(t.names)-1]
+			}
+		}
+	}
+
+	t.pending, t.pendingName = "", ""
+	if !opened && kind != scopeBlock && !strings.HasSuffix(line, ";") {
+		t.pending, t.pendingName = kind, name
+	}
+}
+
+func (t *scopeTracker) push(kind, name string) {
+	t.scopes = append(t.scopes, kind)
+	t.names = append(t.names, name)
+}
+
+// qualified name of the enclosing named namespaces, "a::b" inside namespace a { namespace b {,
+// nested namespace definitions like namespace a::b { are kept as written
+func (t *scopeTracker) namespace() string {
+	var names []string
+	for _, name := range t.names {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, "::")
+}
+
+// reports whether a declaration at the current position is file local, it is inside an
+// anonymous namespace or a static declaration outside of type and function bodies
+func (t *scopeTracker) internal(sig string) bool {
+	if slices.Contains(t.scopes, scopeAnon) {
+		return true
+	}
+
+	if slices.Contains(t.scopes, scopeType) || slices.Contains(t.scopes, scopeBlock) {
+		return false
+	}
+
+	head, _, _ := strings.Cut(sig, "(")
+	return staticRe.MatchString(head)
+}
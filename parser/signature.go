@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"strings"
+)
+
+// storage/function specifiers that prefix a declaration but aren't part of the return type
+var declSpecifiers = map[string]bool{
+	"static": true, "inline": true, "extern": true, "virtual": true, "explicit": true,
+	"constexpr": true, "consteval": true, "friend": true, "export": true,
+}
+
+// splitSignature is a best effort split of a c style function declaration into return type,
+// name and parameter list, ok is false whenever the signature is ambiguous
+func splitSignature(sig, lang string) (ret, name, params string, ok bool) {
+	if lang != "c" && lang != "cpp" {
+		return "", "", "", false
+	}
+
+	open := strings.Index(sig, "(")
+	if open <= 0 || strings.HasPrefix(sig, "#") {
+		return "", "", "", false
+	}
+
+	depth := 0
+	closeIdx := -1
+	for i := open; i < len(sig); i++ {
+		switch sig[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 {
+			closeIdx = i
+			break
+		}
+	}
+	if closeIdx == -1 {
+		return "", "", "", false
+	}
+
+	head := strings.TrimSpace(sig[:open])
+	nameStart := strings.LastIndexFunc(head, func(r rune) bool {
+		return !(r == '_' || r == ':' || r == '~' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) + 1
+	name = head[nameStart:]
+
+	var kept []string
+	for _, word := range strings.Fields(head[:nameStart]) {
+		if !declSpecifiers[word] {
+			kept = append(kept, word)
+		}
+	}
+	ret = strings.Join(kept, " ")
+
+	if name == "" || ret == "" || strings.ContainsAny(ret, "()=") {
+		return "", "", "", false
+	}
+
+	params = strings.TrimSpace(sig[open+1 : closeIdx])
+	return ret, name, params, true
+}
+
+// wrapSignature puts every parameter of a signature on its own line, commas nested in
+// parentheses, templates, brackets or braces don't split, signatures with less than two
+// parameters are returned unchanged
+func wrapSignature(sig string) string {
+	open := strings.Index(sig, "(")
+	if open == -1 || strings.Contains(sig, "\n") {
+		return sig
+	}
+
+	var params []string
+	depth := 0
+	start := open + 1
+	closeIdx := -1
+	for i := open + 1; i < len(sig) && closeIdx == -1; i++ {
+		switch sig[i] {
+		case '(', '<', '[', '{':
+			depth++
+		case ')':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(sig[start:i]))
+				closeIdx = i
+			} else {
+				depth--
+			}
+		case '>', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(sig[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	if closeIdx == -1 || len(params) < 2 {
+		return sig
+	}
+
+	return sig[:open+1] + "\n    " + strings.Join(params, ",\n    ") + "\n" + sig[closeIdx:]
+}
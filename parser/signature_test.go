@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kociumba/kdoc/config"
+)
+
+func TestSplitSignature(t *testing.T) {
+	ret, name, params, ok := splitSignature("int foo(double x)", "c")
+	if !ok || ret != "int" || name != "foo" || params != "double x" {
+		t.Errorf("splitSignature = %q, %q, %q, %v, want int, foo, double x", ret, name, params, ok)
+	}
+}
+
+func TestStructuredSignatureWithReturnTag(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.StructuredSignatures = true })
+
+	md := renderSource(t, "x.c", "c", `/// module
+
+/// doubles x
+/// @return the result
+int foo(double x);
+`)
+
+	if n := strings.Count(md, "**Returns:**"); n != 1 {
+		t.Errorf("got %d Returns labels, want 1:\n%s", n, md)
+	}
+	if !strings.Contains(md, "**Return type:** `int`") || !strings.Contains(md, "`double x`") {
+		t.Errorf("missing the structured signature:\n%s", md)
+	}
+}
+
+func TestWrapSignatures(t *testing.T) {
+	setConfig(t, func(c *config.Config) { c.WrapSignatures = true })
+
+	md := renderSource(t, "x.cpp", "cpp", `/// module
+
+/// blits a region
+void blit(const std::map<int, Surface>& src, Rect area, int x, int y);
+`)
+
+	want := "```cpp\nvoid blit(\n    const std::map<int, Surface>& src,\n    Rect area,\n    int x,\n    int y\n)\n```"
+	if !strings.Contains(md, want) {
+		t.Errorf("want the wrapped signature\n%s\nin:\n%s", want, md)
+	}
+	if !strings.Contains(md, "#### blit\n") || !strings.Contains(md, "](#blit)") {
+		t.Errorf("wrapping changed the heading or anchor:\n%s", md)
+	}
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	pageLinkRe    = regexp.MustCompile(`\]\(([^)\s]+)\)`)
+	pageHeadingRe = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*$`)
+)
+
+// GenerateSingleFile concatenates every page into one document ordered like the index, meant for
+// conversion with pandoc: headings get explicit {#id} attributes prefixed with their page, links
+// between pages are rewritten to those anchors and pages are separated by \newpage hints
+func (p *Parser) GenerateSingleFile(title string, docPath func(f *File) string) string {
+	files := make([]*File, 0, len(p.Files))
+	pages := make(map[string]bool)
+	for i := range p.Files {
+		if !p.Files[i].Passthrough {
+			files = append(files, &p.Files[i])
+			pages[docPath(&p.Files[i])] = true
+		}
+	}
+	p.sortFiles(files, docPath)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# %s {#index}\n\n", title))
+	for _, f := range files {
+		doc := docPath(f)
+		sb.WriteString(fmt.Sprintf("- [%s](#%s)\n", p.relPath(f.Path), pageAnchor(doc)))
+	}
+	sb.WriteString("\n")
+
+	for _, f := range files {
+		sb.WriteString("\\newpage\n\n")
+		page := rewritePage(p.GenerateMarkdownForFile(f), docPath(f), pages)
+		sb.WriteString(strings.TrimRight(page, "\n") + "\n\n")
+	}
+
+	return finishDocument(sb.String())
+}
+
+// anchor of a whole page, "sub/b.md" becomes "sub-b"
+func pageAnchor(doc string) string {
+	return Anchor(strings.ReplaceAll(strings.TrimSuffix(doc, ".md"), "/", " "))
+}
+
+// prefixes the anchors of a page with the page anchor so they stay unique in the combined document
+func rewritePage(page, doc string, pages map[string]bool) string {
+	prefix := pageAnchor(doc)
+	dir := path.Dir(doc)
+
+	// pandoc reads yaml blocks anywhere in the document as metadata
+	if rest, ok := strings.CutPrefix(page, "---\n"); ok {
+		if _, body, ok := strings.Cut(rest, "\n---\n"); ok {
+			page = strings.TrimLeft(body, "\n")
+		}
+	}
+
+	lines := strings.Split(page, "\n")
+	inFence := false
+	first := true
+	for i, line := range lines {
+		if fenceMarker(strings.TrimSpace(line)) != "" {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		if m := pageHeadingRe.FindStringSubmatch(line); m != nil {
+			if first {
+				// the page title carries the page anchor itself
+				lines[i] = fmt.Sprintf("%s %s {#%s}", m[1], m[2], prefix)
+				first = false
+			} else {
+				lines[i] = fmt.Sprintf("%s %s {#%s-%s}", m[1], m[2], prefix, Anchor(m[2]))
+			}
+			continue
+		}
+
+		line = htmlAnchorRe.ReplaceAllString(line, fmt.Sprintf(`<a id="%s-$1"></a>`, prefix))
+		lines[i] = pageLinkRe.ReplaceAllStringFunc(line, func(match string) string {
+			target := pageLinkRe.FindStringSubmatch(match)[1]
+			if strings.Contains(target, "://") || strings.HasPrefix(target, "mailto:") {
+				return match
+			}
+
+			file, frag, _ := strings.Cut(target, "#")
+			targetPrefix := prefix
+			if file != "" {
+				resolved := path.Join(dir, file)
+				if !pages[resolved] {
+					return match
+				}
+				targetPrefix = pageAnchor(resolved)
+			}
+
+			if frag == "" {
+				return fmt.Sprintf("](#%s)", targetPrefix)
+			}
+			return fmt.Sprintf("](#%s-%s)", targetPrefix, frag)
+		})
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	tagLineRe  = regexp.MustCompile(`^\s*[@\\](\w+)\b\s*(.*)$`)
+	paramDirRe = regexp.MustCompile(`^\[(?:in|out|in,\s*out)\]\s*`)
+)
+
+// takeTags removes every line starting with one of the given @tags from desc,
+// returning the remaining description and the tag values in order of appearance
+func takeTags(desc string, tags ...string) (string, map[string][]string) {
+	values := make(map[string][]string)
+	if !strings.Contains(desc, "@") && !strings.Contains(desc, "\\") {
+		return desc, values
+	}
+
+	var kept []string
+	for _, line := range strings.Split(desc, "\n") {
+		if m := tagLineRe.FindStringSubmatch(line); m != nil && slices.Contains(tags, m[1]) {
+			values[m[1]] = append(values[m[1]], strings.TrimSpace(m[2]))
+			continue
+		}
+
+		kept = append(kept, line)
+	}
+
+	return strings.TrimSpace(strings.Join(kept, "\n")), values
+}
+
+// splits comma separated tag values, so "@author A, B" and two @author lines are equivalent
+func splitNames(values []string) []string {
+	var names []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// splits @param values into name and description, a doxygen direction like [in] is dropped
+func parseParams(values []string) []ParamDoc {
+	var params []ParamDoc
+	for _, v := range values {
+		name, desc, _ := strings.Cut(paramDirRe.ReplaceAllString(v, ""), " ")
+		if name != "" {
+			params = append(params, ParamDoc{Name: name, Description: strings.TrimSpace(desc)})
+		}
+	}
+
+	return params
+}
+
+// escapes a value for a markdown table cell, pipes would end the cell and newlines the row
+func tableCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", "\\|"), "\n", " ")
+}
@@ -0,0 +1,30 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParamTableAndReturns(t *testing.T) {
+	md := renderSource(t, "x.c", "c", `/// module
+
+/// combines two flag sets
+/// @param[in] a the first set, like A|B
+/// @param b the second set
+/// @return a | b
+int combine(int a, int b);
+`)
+
+	table := "**Parameters:**\n\n| Name | Description |\n| --- | --- |\n" +
+		"| `a` | the first set, like A\\|B |\n" +
+		"| `b` | the second set |\n\n"
+	if !strings.Contains(md, table) {
+		t.Errorf("want the parameter table\n%s\nin:\n%s", table, md)
+	}
+	if !strings.Contains(md, "**Returns:** a | b\n\n```c\nint combine(int a, int b)\n```") {
+		t.Errorf("want the Returns line above the signature in:\n%s", md)
+	}
+	if strings.Contains(md, "@param") || strings.Contains(md, "@return") {
+		t.Errorf("the tags weren't stripped from the description:\n%s", md)
+	}
+}
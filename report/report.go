@@ -0,0 +1,23 @@
+package report
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+var warnings atomic.Int64
+
+// Warnf logs a recoverable problem and counts it, so strict runs can fail at the end
+// instead of silently producing incomplete docs
+func Warnf(format string, args ...any) {
+	warnings.Add(1)
+	log.Printf(format, args...)
+}
+
+func Count() int {
+	return int(warnings.Load())
+}
+
+func Reset() {
+	warnings.Store(0)
+}
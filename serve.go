@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kociumba/kdoc/config"
+	"github.com/kociumba/kdoc/output"
+	"github.com/kociumba/kdoc/parser"
+	"github.com/urfave/cli/v3"
+)
+
+// markdown renderer loaded by served pages, left out in offline mode where pages fall
+// back to showing the markdown source in a <pre>
+const markedScript = `<script src="https://cdn.jsdelivr.net/npm/marked/marked.min.js"></script>
+`
+
+// pages are rendered client side, the script polls /_kdoc/version and reloads
+// the page whenever the docs were regenerated
+const servePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+%s<style>body{max-width:900px;margin:2rem auto;padding:0 1rem;font-family:sans-serif}pre{overflow-x:auto}</style>
+%s</head>
+<body>
+<div id="content"></div>
+<script>
+const source = %s;
+document.getElementById("content").innerHTML = window.marked ? marked.parse(source) : "<pre>" + source.replace(/</g, "&lt;") + "</pre>";
+let version = %d;
+setInterval(async () => {
+	try {
+		const res = await fetch("/_kdoc/version");
+		if (Number(await res.text()) !== version) location.reload();
+	} catch (e) {}
+}, 1000);
+</script>
+</body>
+</html>
+`
+
+// metadata of the generated pages keyed by their slash separated path relative to the output
+// root, refreshed by every generate run so served pages get meta tags from the parsed files
+var pageMetas struct {
+	mu    sync.Mutex
+	pages map[string]parser.PageMeta
+}
+
+func storePageMetas(p *parser.Parser, scan_root string) {
+	pages := make(map[string]parser.PageMeta, len(p.Files))
+	for i := range p.Files {
+		if !p.Files[i].Passthrough {
+			pages[docFilename(scan_root, &p.Files[i], "")] = p.PageMeta(&p.Files[i])
+		}
+	}
+
+	pageMetas.mu.Lock()
+	pageMetas.pages = pages
+	pageMetas.mu.Unlock()
+}
+
+func lookupPageMeta(rel string) (parser.PageMeta, bool) {
+	pageMetas.mu.Lock()
+	defer pageMetas.mu.Unlock()
+
+	meta, ok := pageMetas.pages[rel]
+	return meta, ok
+}
+
+type docServer struct {
+	mu      sync.Mutex
+	version int
+	raw     bool
+}
+
+func (s *docServer) currentVersion() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+func (s *docServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	files := http.FileServer(http.Dir(out))
+
+	mux.HandleFunc("/_kdoc/version", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, s.currentVersion())
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if s.raw || !strings.HasSuffix(r.URL.Path, ".md") {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		// cleaning a rooted path can't escape the output dir
+		path := filepath.Join(out, filepath.FromSlash(pathpkg.Clean("/"+r.URL.Path)))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// pages served with --no-generate have no parsed metadata, only the title is known
+		meta, ok := lookupPageMeta(strings.TrimPrefix(pathpkg.Clean("/"+r.URL.Path), "/"))
+		if !ok {
+			meta = parser.PageMeta{Title: filepath.Base(path)}
+		}
+
+		source, _ := json.Marshal(parser.RewriteFences(string(data), "html"))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		script := If(config.CFG.Offline, "", markedScript)
+		fmt.Fprintf(w, servePage, html.EscapeString(filepath.Base(path)), meta.HTML(), script, source, s.currentVersion())
+	})
+
+	return mux
+}
+
+// cheap fingerprint of the scanned sources, changes whenever a file is added, removed or modified
+func sourceFingerprint(c *cli.Command) uint64 {
+	scan_root, excludes, err := scanTargets(c)
+	if err != nil {
+		return 0
+	}
+
+	h := fnv.New64a()
+	for _, path := range collectFiles(scan_root, excludes, config.CFG.ExtensionsToLangs) {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s|%d|%d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return h.Sum64()
+}
+
+// polls the sources and regenerates the docs when they change
+func (s *docServer) watch(ctx context.Context, c *cli.Command, interval time.Duration) {
+	last := sourceFingerprint(c)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := sourceFingerprint(c)
+		if current == last {
+			continue
+		}
+		last = current
+
+		fmt.Println("Source change detected, regenerating docs")
+		if err := generate(c, generateOptions{}); err != nil {
+			log.Printf("Error regenerating docs: %v", err)
+			continue
+		}
+
+		s.mu.Lock()
+		s.version++
+		s.mu.Unlock()
+	}
+}
+
+func serve(ctx context.Context, c *cli.Command) error {
+	if output.IsZip(out) {
+		return fmt.Errorf("serve needs a directory output, got %s", out)
+	}
+
+	if !c.Bool("no-generate") {
+		if err := generate(c, generateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	s := &docServer{raw: c.Bool("raw")}
+	go s.watch(ctx, c, time.Second)
+
+	addr := fmt.Sprintf("localhost:%d", c.Int("port"))
+	fmt.Printf("Serving %s on http://%s\n", out, addr)
+
+	return http.ListenAndServe(addr, s.handler())
+}
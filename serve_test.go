@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+func TestOfflineHasNoExternalURLs(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "offline = true\n",
+		"a.c":       "/// module\n\n/// doc\nvoid foo(void);\n",
+	})
+	gitCommitAll(t, dir, "add a")
+
+	if err := runKdoc(t, "--root", dir, "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	if page := readFile(t, filepath.Join(dir, "docs", "a.md")); !strings.Contains(page, "Jane Doe") {
+		t.Fatalf("a.md has no git card:\n%s", page)
+	}
+	docs, _ := filepath.Glob(filepath.Join(dir, "docs", "*"))
+	for _, path := range docs {
+		if page := readFile(t, path); strings.Contains(page, "http") {
+			t.Errorf("%s links to an external service:\n%s", filepath.Base(path), page)
+		}
+	}
+
+	srv := httptest.NewServer((&docServer{}).handler())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if strings.Contains(string(body), "https://") {
+		t.Errorf("served page loads an external resource:\n%s", body)
+	}
+}
+
+func TestServeRegeneratesOnChange(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"a.c":       "/// module\n\n/// first version\nvoid foo(void);\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &docServer{}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), "first version") {
+		t.Fatalf("GET /a.md = %d:\n%s", res.StatusCode, body)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.watch(ctx, &cli.Command{}, 10*time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// give the watcher time to take its first fingerprint
+	time.Sleep(50 * time.Millisecond)
+	writeTree(t, dir, map[string]string{"a.c": "/// module\n\n/// second, longer version\nvoid foo(void);\n"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.currentVersion() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("source change did not trigger a regeneration")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if page := readFile(t, filepath.Join(dir, "docs", "a.md")); !strings.Contains(page, "second, longer version") {
+		t.Errorf("a.md was not regenerated:\n%s", page)
+	}
+}
+
+func TestServedPageMetaTags(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"kdoc.toml": "",
+		"widget.c":  "/// Draws & lays out widgets\n/// second line of the module\n\n/// doc\nvoid foo(void);\n",
+	})
+
+	if err := runKdoc(t, "--root", dir, "--no-git", "generate"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer((&docServer{}).handler())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/widget.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+
+	head, _, _ := strings.Cut(string(body), "</head>")
+	for _, tag := range []string{
+		`<meta property="og:title" content="widget.c">`,
+		`<meta property="og:description" content="Draws &amp; lays out widgets">`,
+	} {
+		if !strings.Contains(head, tag) {
+			t.Errorf("head misses %s:\n%s", tag, head)
+		}
+	}
+}